@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/yubo/golib/orm"
+	"github.com/yubo/gotool/mysqlschema"
 )
 
 type Differ struct {
@@ -63,7 +65,7 @@ func (p *Differ) CompareDb() error {
 	add, drop, update := strDiff(oTab, nTab)
 
 	for _, v := range add {
-		if sql, err := getTableCreateSql(p.nDb, v); err != nil {
+		if sql, err := mysqlschema.CreateTableSql(p.nDb, v); err != nil {
 			return err
 		} else {
 			p.addSql(sql)
@@ -84,7 +86,7 @@ func (p *Differ) CompareDb() error {
 }
 
 func (p *Differ) compareTable(tableName string) error {
-	d, err := parseTable(p.nDb, tableName)
+	d, err := mysqlschema.ParseTable(p.nDb, tableName)
 	if err != nil {
 		return err
 	}
@@ -92,7 +94,7 @@ func (p *Differ) compareTable(tableName string) error {
 		return nil
 	}
 
-	s, err := parseTable(p.oDb, tableName)
+	s, err := mysqlschema.ParseTable(p.oDb, tableName)
 	if err != nil {
 		return err
 	}
@@ -101,30 +103,33 @@ func (p *Differ) compareTable(tableName string) error {
 	if err != nil {
 		return err
 	}
+	fkAdd, fkDrop := p.mysqlDiffForeignKey(s, d)
 
-	// 1. drop index
+	// 1. drop foreign key
+	for _, v := range fkDrop {
+		p.addSql(v)
+	}
+	// 2. drop index
 	for _, v := range drop {
 		p.addSql(v)
 	}
-	// 2. drop & add field
+	// 3. drop & add field
 	if err := p.mysqlDiffField(s, d); err != nil {
 		return err
 	}
-	// 3. add index
+	// 4. add index
 	for _, v := range add {
 		p.addSql(v)
 	}
+	// 5. add foreign key
+	for _, v := range fkAdd {
+		p.addSql(v)
+	}
 
 	return nil
 }
 
-func getTableCreateSql(db orm.DB, table string) (sql string, err error) {
-	var name string
-	err = db.Query("show create table "+table).Row(&name, &sql)
-	return
-}
-
-func (p *Differ) mysqlDiffField(oTab, nTab *MysqlTable) error {
+func (p *Differ) mysqlDiffField(oTab, nTab *mysqlschema.MysqlTable) error {
 	oFlds := oTab.Fields
 	nFlds := nTab.Fields
 	oMap := make(map[string]string, len(oFlds))
@@ -156,7 +161,7 @@ func (p *Differ) mysqlDiffField(oTab, nTab *MysqlTable) error {
 	lastFld := ""
 	for _, nf := range nFlds {
 		// 找一个基准
-		var fp *FieldInfo
+		var fp *mysqlschema.FieldInfo
 		for i := oIdx; i < len(oFlds); i++ {
 			f := oFlds[i]
 			if ignoreMap[f.Name] {
@@ -221,7 +226,7 @@ func typeTrimmer(typ string) string {
 	}
 }
 
-func (p *Differ) mysqlDiffKey(oTab, nTab *MysqlTable) (add, del []string, err error) {
+func (p *Differ) mysqlDiffKey(oTab, nTab *mysqlschema.MysqlTable) (add, del []string, err error) {
 	oKeys := oTab.Keys
 	nKeys := nTab.Keys
 	oMap := make(map[string]bool, len(oKeys))
@@ -251,7 +256,7 @@ func (p *Differ) mysqlDiffKey(oTab, nTab *MysqlTable) (add, del []string, err er
 
 	oIdx := 0
 	for _, nk := range nKeys {
-		var kp *KeyInfo
+		var kp *mysqlschema.KeyInfo
 		for i := oIdx; i < len(oKeys); i++ {
 			k := oKeys[i]
 			if ignoreMap[k.Name] {
@@ -306,6 +311,47 @@ func (p *Differ) mysqlDiffKey(oTab, nTab *MysqlTable) (add, del []string, err er
 	return
 }
 
+// mysqlDiffForeignKey compares the foreign keys by name, a modified one
+// is dropped and added again
+func (p *Differ) mysqlDiffForeignKey(oTab, nTab *mysqlschema.MysqlTable) (add, del []string) {
+	oMap := make(map[string]mysqlschema.ForeignKeyInfo, len(oTab.ForeignKeys))
+	nMap := make(map[string]bool, len(nTab.ForeignKeys))
+	for _, fk := range oTab.ForeignKeys {
+		oMap[fk.Name] = fk
+	}
+	for _, fk := range nTab.ForeignKeys {
+		nMap[fk.Name] = true
+	}
+
+	// eg.: alter table xxx drop foreign key fk_name
+	for _, fk := range oTab.ForeignKeys {
+		if !nMap[fk.Name] {
+			del = append(del, fmt.Sprintf("alter table %s drop foreign key %s", oTab.Name, fk.Name))
+		}
+	}
+
+	for _, fk := range nTab.ForeignKeys {
+		if ofk, ok := oMap[fk.Name]; ok {
+			if ofk == fk {
+				continue
+			}
+			del = append(del, fmt.Sprintf("alter table %s drop foreign key %s", nTab.Name, fk.Name))
+		}
+
+		// eg.: alter table xxx add constraint fk_name foreign key (`a`) references yyy (`id`) on delete cascade
+		sql := fmt.Sprintf("alter table %s add constraint %s foreign key (%s) references %s (%s)",
+			nTab.Name, fk.Name, fk.Fields, fk.RefTable, fk.RefFields)
+		if fk.OnDelete != "" {
+			sql += " on delete " + strings.ToLower(fk.OnDelete)
+		}
+		if fk.OnUpdate != "" {
+			sql += " on update " + strings.ToLower(fk.OnUpdate)
+		}
+		add = append(add, sql)
+	}
+	return
+}
+
 func strDiff(o, n []string) (add, del, eq []string) {
 	s := map[string]bool{}
 	d := map[string]bool{}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/yubo/gotool/mysqlschema"
 )
 
 type item struct {
@@ -158,3 +159,51 @@ func diffItem(oItems, nItems []*item) (add, del, update []*item) {
 	}
 	return
 }
+
+func TestDiffForeignKey(t *testing.T) {
+	parse := func(fks ...string) *mysqlschema.MysqlTable {
+		sql := "CREATE TABLE `order` (\n" +
+			"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `user_id` bigint(20) unsigned NOT NULL,\n" +
+			"  PRIMARY KEY (`id`)"
+		for _, fk := range fks {
+			sql += ",\n  " + fk
+		}
+		tab, err := mysqlschema.ParseTableSql(sql + "\n) ENGINE=InnoDB;")
+		require.NoError(t, err)
+		return tab
+	}
+
+	fkUser := "CONSTRAINT `fk_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`)"
+	fkUserCascade := fkUser + " ON DELETE CASCADE"
+	fkOwner := "CONSTRAINT `fk_owner` FOREIGN KEY (`user_id`) REFERENCES `owner` (`id`)"
+
+	cases := []struct {
+		src []string
+		dst []string
+		add []string
+		del []string
+	}{{
+		src: []string{fkUser},
+		dst: []string{fkUser},
+	}, {
+		dst: []string{fkUserCascade},
+		add: []string{"alter table order add constraint fk_user foreign key (`user_id`) references user (`id`) on delete cascade"},
+	}, {
+		src: []string{fkUser, fkOwner},
+		dst: []string{fkUser},
+		del: []string{"alter table order drop foreign key fk_owner"},
+	}, {
+		src: []string{fkUser},
+		dst: []string{fkUserCascade},
+		add: []string{"alter table order add constraint fk_user foreign key (`user_id`) references user (`id`) on delete cascade"},
+		del: []string{"alter table order drop foreign key fk_user"},
+	}}
+
+	p := &Differ{}
+	for i, c := range cases {
+		add, del := p.mysqlDiffForeignKey(parse(c.src...), parse(c.dst...))
+		require.Equal(t, c.add, add, "case-%d-add", i)
+		require.Equal(t, c.del, del, "case-%d-del", i)
+	}
+}
@@ -7,4 +7,8 @@ require (
 	github.com/spf13/cobra v1.4.0
 	github.com/stretchr/testify v1.7.1
 	github.com/yubo/golib v0.0.1
+	github.com/yubo/gotool/mysqlschema v0.1.0
 )
+
+// the local copy until mysqlschema/v0.1.0 is published
+replace github.com/yubo/gotool/mysqlschema => ../mysqlschema
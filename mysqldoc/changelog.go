@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/yubo/golib/orm"
+	"github.com/yubo/gotool/mysqlschema"
+)
+
+const (
+	changeAddTable     = "addTable"
+	changeDropTable    = "dropTable"
+	changeAddColumn    = "addColumn"
+	changeDropColumn   = "dropColumn"
+	changeModifyColumn = "modifyColumn"
+	changeAddKey       = "addKey"
+	changeDropKey      = "dropKey"
+	changeModifyKey    = "modifyKey"
+	changeAddFk        = "addForeignKey"
+	changeDropFk       = "dropForeignKey"
+	changeModifyFk     = "modifyForeignKey"
+)
+
+var changeNames = map[string]string{
+	changeAddTable:     "新增表",
+	changeDropTable:    "删除表",
+	changeAddColumn:    "新增字段",
+	changeDropColumn:   "删除字段",
+	changeModifyColumn: "修改字段",
+	changeAddKey:       "新增索引",
+	changeDropKey:      "删除索引",
+	changeModifyKey:    "修改索引",
+	changeAddFk:        "新增外键",
+	changeDropFk:       "删除外键",
+	changeModifyFk:     "修改外键",
+}
+
+// changelogDoc lists the schema changes since an older version
+type changelogDoc struct {
+	Since   string       `json:"since"`
+	Changes []*changeDoc `json:"changes"`
+}
+
+type changeDoc struct {
+	Table string `json:"table"`
+	Type  string `json:"type"`           // addTable, dropColumn, modifyKey, ...
+	Name  string `json:"name,omitempty"` // column, key or foreign key name
+	From  string `json:"from,omitempty"` // old definition
+	To    string `json:"to,omitempty"`   // new definition
+}
+
+// changeName returns the display name of a change type
+func changeName(typ string) string {
+	if s, ok := changeNames[typ]; ok {
+		return s
+	}
+	return typ
+}
+
+// loadSource returns the tables of src, which is either a snapshot
+// written by `mysqldoc snapshot` (*.json), a sql file, "-" for stdin,
+// or a dsn
+func loadSource(src string) ([]*mysqlschema.MysqlTable, error) {
+	if src == "-" {
+		return mysqlschema.ParseFile(src)
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		db, err := orm.Open("mysql", src)
+		if err != nil {
+			return nil, fmt.Errorf("%s is neither a file nor a valid dsn: %s", sourceName(src), err)
+		}
+		defer db.Close()
+		return mysqlschema.ParseTables(db)
+	}
+
+	if strings.ToLower(filepath.Ext(src)) == ".json" {
+		return loadSnapshot(src)
+	}
+	return mysqlschema.ParseFile(src)
+}
+
+func loadSnapshot(file string) ([]*mysqlschema.MysqlTable, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []*mysqlschema.MysqlTable
+	if err := json.Unmarshal(b, &tables); err != nil {
+		return nil, fmt.Errorf("parse snapshot %s: %s", file, err)
+	}
+	return tables, nil
+}
+
+func writeSnapshot(w io.Writer, tables []*mysqlschema.MysqlTable) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tables)
+}
+
+// sourceName returns a printable name of src, the credentials of a
+// dsn are left out
+func sourceName(src string) string {
+	if _, err := os.Stat(src); err == nil || src == "-" {
+		return src
+	}
+	if cf, err := mysql.ParseDSN(src); err == nil {
+		return cf.Addr + "/" + cf.DBName
+	}
+	return "dsn"
+}
+
+// diffTables compares the old and new versions of the tables, child
+// tables of merge tables are skipped
+func diffTables(oTabs, nTabs []*mysqlschema.MysqlTable) []*changeDoc {
+	var changes []*changeDoc
+
+	oMap := make(map[string]*mysqlschema.MysqlTable, len(oTabs))
+	for _, t := range oTabs {
+		if !t.IsChild {
+			oMap[t.Name] = t
+		}
+	}
+	nMap := make(map[string]bool, len(nTabs))
+
+	for _, n := range nTabs {
+		if n.IsChild {
+			continue
+		}
+		nMap[n.Name] = true
+
+		o, ok := oMap[n.Name]
+		if !ok {
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeAddTable})
+			continue
+		}
+		changes = append(changes, diffFields(o, n)...)
+		changes = append(changes, diffKeys(o, n)...)
+		changes = append(changes, diffForeignKeys(o, n)...)
+	}
+
+	for _, o := range oTabs {
+		if !o.IsChild && !nMap[o.Name] {
+			changes = append(changes, &changeDoc{Table: o.Name, Type: changeDropTable})
+		}
+	}
+
+	return changes
+}
+
+func diffFields(o, n *mysqlschema.MysqlTable) []*changeDoc {
+	var changes []*changeDoc
+
+	oMap := make(map[string]string, len(o.Fields))
+	for _, f := range o.Fields {
+		oMap[f.Name] = f.Desc
+	}
+	nMap := make(map[string]bool, len(n.Fields))
+
+	for _, f := range n.Fields {
+		nMap[f.Name] = true
+		desc, ok := oMap[f.Name]
+		switch {
+		case !ok:
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeAddColumn, Name: f.Name, To: f.Desc})
+		case desc != f.Desc:
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeModifyColumn, Name: f.Name, From: desc, To: f.Desc})
+		}
+	}
+
+	for _, f := range o.Fields {
+		if !nMap[f.Name] {
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeDropColumn, Name: f.Name, From: f.Desc})
+		}
+	}
+
+	return changes
+}
+
+// diffKeys compares the keys by type and name, e.g. "PRIMARY KEY"
+func diffKeys(o, n *mysqlschema.MysqlTable) []*changeDoc {
+	var changes []*changeDoc
+
+	keyName := func(k mysqlschema.KeyInfo) string {
+		return strings.TrimSpace(k.Type + " " + k.Name)
+	}
+	keyFields := func(fields string) string {
+		return strings.Join(splitKeyFields(fields), ", ")
+	}
+
+	oMap := make(map[string]string, len(o.Keys))
+	for _, k := range o.Keys {
+		oMap[keyName(k)] = k.Fields
+	}
+	nMap := make(map[string]bool, len(n.Keys))
+
+	for _, k := range n.Keys {
+		name := keyName(k)
+		nMap[name] = true
+		fields, ok := oMap[name]
+		switch {
+		case !ok:
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeAddKey, Name: name, To: keyFields(k.Fields)})
+		case fields != k.Fields:
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeModifyKey, Name: name, From: keyFields(fields), To: keyFields(k.Fields)})
+		}
+	}
+
+	for _, k := range o.Keys {
+		if name := keyName(k); !nMap[name] {
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeDropKey, Name: name, From: keyFields(k.Fields)})
+		}
+	}
+
+	return changes
+}
+
+// diffForeignKeys compares the foreign keys by name, like mysqldiff
+func diffForeignKeys(o, n *mysqlschema.MysqlTable) []*changeDoc {
+	var changes []*changeDoc
+
+	oMap := make(map[string]string, len(o.ForeignKeys))
+	for _, fk := range o.ForeignKeys {
+		oMap[fk.Name] = foreignKeyDef(fk)
+	}
+	nMap := make(map[string]bool, len(n.ForeignKeys))
+
+	for _, fk := range n.ForeignKeys {
+		nMap[fk.Name] = true
+		def, ok := oMap[fk.Name]
+		switch {
+		case !ok:
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeAddFk, Name: fk.Name, To: foreignKeyDef(fk)})
+		case def != foreignKeyDef(fk):
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeModifyFk, Name: fk.Name, From: def, To: foreignKeyDef(fk)})
+		}
+	}
+
+	for _, fk := range o.ForeignKeys {
+		if !nMap[fk.Name] {
+			changes = append(changes, &changeDoc{Table: n.Name, Type: changeDropFk, Name: fk.Name, From: foreignKeyDef(fk)})
+		}
+	}
+
+	return changes
+}
+
+// foreignKeyDef returns e.g. "user_id -> user (id) ON DELETE CASCADE"
+func foreignKeyDef(fk mysqlschema.ForeignKeyInfo) string {
+	def := fmt.Sprintf("%s -> %s (%s)", strings.Join(splitKeyFields(fk.Fields), ", "),
+		fk.RefTable, strings.Join(splitKeyFields(fk.RefFields), ", "))
+	if fk.OnDelete != "" {
+		def += " ON DELETE " + fk.OnDelete
+	}
+	if fk.OnUpdate != "" {
+		def += " ON UPDATE " + fk.OnUpdate
+	}
+	return def
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yubo/gotool/mysqlschema"
+)
+
+func TestDiffTables(t *testing.T) {
+	oTabs, err := loadSource("./testdata/schema_old.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nTabs, err := loadSource("./testdata/schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range diffTables(oTabs, nTabs) {
+		got = append(got, fmt.Sprintf("%s %s %s [%s] [%s]", c.Table, c.Type, c.Name, c.From, c.To))
+	}
+
+	want := []string{
+		"user modifyColumn email [varchar(128) NOT NULL DEFAULT ''] [varchar(256) NOT NULL DEFAULT '']",
+		"user addColumn phone [] [varchar(16) DEFAULT NULL]",
+		"user addKey UNIQUE KEY index_name [] [name]",
+		"order dropColumn remark [varchar(64) DEFAULT NULL] []",
+		"order modifyKey KEY fk_order_user [user_id, amount] [user_id]",
+		"user_log addTable  [] []",
+		"legacy dropTable  [] []",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if changes := diffTables(nTabs, nTabs); len(changes) != 0 {
+		t.Errorf("expected no changes, got %d", len(changes))
+	}
+}
+
+func TestDiffForeignKeys(t *testing.T) {
+	fk := func(name, fields, refTable, onDelete string) mysqlschema.ForeignKeyInfo {
+		return mysqlschema.ForeignKeyInfo{Name: name, Fields: fields, RefTable: refTable, RefFields: "`id`", OnDelete: onDelete}
+	}
+	o := &mysqlschema.MysqlTable{Name: "order", ForeignKeys: []mysqlschema.ForeignKeyInfo{
+		fk("fk_user", "`user_id`", "user", "CASCADE"),
+		fk("fk_shop", "`shop_id`", "shop", ""),
+		fk("fk_item", "`item_id`", "item", ""),
+	}}
+	n := &mysqlschema.MysqlTable{Name: "order", ForeignKeys: []mysqlschema.ForeignKeyInfo{
+		fk("fk_user", "`user_id`", "user", "CASCADE"),
+		fk("fk_shop", "`shop_id`", "shop", "SET NULL"),
+		fk("fk_coupon", "`coupon_id`", "coupon", ""),
+	}}
+
+	var got []string
+	for _, c := range diffTables([]*mysqlschema.MysqlTable{o}, []*mysqlschema.MysqlTable{n}) {
+		got = append(got, fmt.Sprintf("%s %s %s [%s] [%s]", c.Table, c.Type, c.Name, c.From, c.To))
+	}
+
+	want := []string{
+		"order modifyForeignKey fk_shop [shop_id -> shop (id)] [shop_id -> shop (id) ON DELETE SET NULL]",
+		"order addForeignKey fk_coupon [] [coupon_id -> coupon (id)]",
+		"order dropForeignKey fk_item [item_id -> item (id)] []",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestChangelogSnapshot(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "old.json")
+
+	p := &Doc{Config: &Config{file: "./testdata/schema_old.sql"}}
+	if err := p.snapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	p = &Doc{Config: &Config{file: "./testdata/schema.sql", since: snapshot}}
+	doc, err := p.schemaDoc(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Changelog == nil || doc.Changelog.Since != snapshot || len(doc.Changelog.Changes) != 7 {
+		t.Fatalf("unexpected changelog %+v", doc.Changelog)
+	}
+
+	for _, format := range []string{"markdown", "asciidoc", "html"} {
+		r, _ := newRenderer(format)
+		var buf bytes.Buffer
+		if err := r.Render(&buf, doc); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []string{"变更记录", "新增字段", "删除表", "varchar(256)"} {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("%s output missing %q", format, s)
+			}
+		}
+	}
+}
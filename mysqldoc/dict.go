@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const keyPrefix = "name_"
+
+// dictionary holds the descriptions of tables and columns,
+// loaded from a yaml/json file or the legacy "name_key: value" text file.
+//
+//	tables:
+//	  user: {zh: 用户表, en: users}
+//	columns:
+//	  id: ID                  # global, used by all tables
+//	  user.name: {zh: 用户名}  # table.column, overrides the global entry
+//
+// An entry is either a plain string, used for all languages,
+// or a map of language to description selected by --lang.
+type dictionary struct {
+	file    string
+	lang    string
+	tables  map[string]dictEntry
+	columns map[string]dictEntry
+	raw     []byte // file content, kept by save
+}
+
+// dictEntry maps language to description, "" is the language neutral one
+type dictEntry map[string]string
+
+const dictDefaultLang = "default"
+
+type dictFile struct {
+	Tables  map[string]interface{} `json:"tables,omitempty" yaml:"tables,omitempty"`
+	Columns map[string]interface{} `json:"columns,omitempty" yaml:"columns,omitempty"`
+}
+
+func newDictionary(file, lang string) *dictionary {
+	return &dictionary{
+		file:    file,
+		lang:    lang,
+		tables:  map[string]dictEntry{},
+		columns: map[string]dictEntry{},
+	}
+}
+
+// loadDict loads the dictionary file, a nonexistent file is an empty dictionary
+func loadDict(file, lang string) (*dictionary, error) {
+	d := newDictionary(file, lang)
+	if file == "" {
+		return d, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.raw = b
+
+	if !d.structured() {
+		d.parseText(b)
+		return d, nil
+	}
+
+	f := &dictFile{}
+	if d.isJson() {
+		err = json.Unmarshal(b, f)
+	} else {
+		err = yaml.Unmarshal(b, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse dict %s: %s", file, err)
+	}
+
+	if d.tables, err = parseDictEntries(f.Tables); err != nil {
+		return nil, fmt.Errorf("parse dict %s tables: %s", file, err)
+	}
+	if d.columns, err = parseDictEntries(f.Columns); err != nil {
+		return nil, fmt.Errorf("parse dict %s columns: %s", file, err)
+	}
+
+	return d, nil
+}
+
+func (p *dictionary) structured() bool {
+	switch strings.ToLower(filepath.Ext(p.file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+func (p *dictionary) isJson() bool {
+	return strings.ToLower(filepath.Ext(p.file)) == ".json"
+}
+
+// parseText parses the legacy format, one "name_column: description" per
+// line, the description may contain ":", lines starting with # are comments
+func (p *dictionary) parseText(b []byte) {
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, keyPrefix)
+		line = strings.ReplaceAll(line, "：", ":")
+		if fs := strings.SplitN(line, ":", 2); len(fs) == 2 && strings.TrimSpace(fs[0]) != "" {
+			p.columns[strings.TrimSpace(fs[0])] = dictEntry{"": strings.TrimSpace(fs[1])}
+		}
+	}
+}
+
+func parseDictEntries(in map[string]interface{}) (map[string]dictEntry, error) {
+	out := make(map[string]dictEntry, len(in))
+	for k, v := range in {
+		e := dictEntry{}
+		switch t := v.(type) {
+		case string:
+			e[""] = t
+		case map[string]interface{}:
+			for lang, s := range t {
+				e.set(lang, fmt.Sprint(s))
+			}
+		case map[interface{}]interface{}: // yaml with non-string keys
+			for lang, s := range t {
+				e.set(fmt.Sprint(lang), fmt.Sprint(s))
+			}
+		case nil:
+		default:
+			return nil, fmt.Errorf("invalid entry %s: %v", k, v)
+		}
+		out[k] = e
+	}
+	return out, nil
+}
+
+func (p dictEntry) set(lang, s string) {
+	if lang == dictDefaultLang {
+		lang = ""
+	}
+	p[lang] = s
+}
+
+func (p dictEntry) get(lang string) (string, bool) {
+	if s, ok := p[lang]; ok && s != "" {
+		return s, true
+	}
+	if s, ok := p[""]; ok && s != "" {
+		return s, true
+	}
+	return "", false
+}
+
+func (p dictEntry) marshal() interface{} {
+	if s, ok := p[""]; ok && len(p) == 1 {
+		return s
+	}
+
+	m := make(map[string]string, len(p))
+	for lang, s := range p {
+		if lang == "" {
+			lang = dictDefaultLang
+		}
+		m[lang] = s
+	}
+	return m
+}
+
+// column returns the description of table.column, falls back to the
+// global column entry
+func (p *dictionary) column(table, column string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	if s, ok := p.columns[table+"."+column].get(p.lang); ok {
+		return s, true
+	}
+	return p.columns[column].get(p.lang)
+}
+
+func (p *dictionary) table(table string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	return p.tables[table].get(p.lang)
+}
+
+// sync adds the undescribed tables and columns of doc to the dictionary
+// with an empty description in the current language, to be filled in
+// later, existing entries are left untouched, even empty ones. Column
+// entries are global unless perTable is set, tables are only synced to
+// the structured formats.
+// It returns the added keys.
+func (p *dictionary) sync(doc *schemaDoc, perTable bool) []string {
+	var added []string
+	add := func(m map[string]dictEntry, key string) {
+		e, ok := m[key]
+		if !ok {
+			e = dictEntry{}
+			m[key] = e
+		}
+		_, hasLang := e[p.lang]
+		_, hasNeutral := e[""]
+		if hasLang || hasNeutral {
+			return
+		}
+		e[p.lang] = ""
+		added = append(added, key)
+	}
+
+	for _, t := range doc.Tables {
+		if t.Desc == "" && p.structured() {
+			add(p.tables, t.Name)
+		}
+		for _, f := range t.Fields {
+			if f.DescFrom != descFromName {
+				continue
+			}
+			key := f.Name
+			if perTable {
+				key = t.Name + "." + f.Name
+			}
+			add(p.columns, key)
+		}
+	}
+
+	sort.Strings(added)
+	return added
+}
+
+// save writes the dictionary back to its file. The missing entries are
+// added to the yaml and text files, their comments and the order of the
+// existing entries are kept, json files are rewritten.
+func (p *dictionary) save() error {
+	if !p.structured() {
+		return p.saveText()
+	}
+	if !p.isJson() {
+		return p.saveYaml()
+	}
+
+	f := &dictFile{
+		Tables:  make(map[string]interface{}, len(p.tables)),
+		Columns: make(map[string]interface{}, len(p.columns)),
+	}
+	for k, v := range p.tables {
+		f.Tables[k] = v.marshal()
+	}
+	for k, v := range p.columns {
+		f.Columns[k] = v.marshal()
+	}
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p.file, b, 0644)
+}
+
+// saveYaml adds the missing entries and languages to the yaml nodes of
+// the file
+func (p *dictionary) saveYaml() error {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(p.raw, doc); err != nil {
+		return fmt.Errorf("parse dict %s: %s", p.file, err)
+	}
+	if doc.Kind == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("parse dict %s: not a mapping", p.file)
+	}
+
+	if err := addDictNodes(root, "tables", p.tables); err != nil {
+		return err
+	}
+	if err := addDictNodes(root, "columns", p.columns); err != nil {
+		return err
+	}
+
+	b := &bytes.Buffer{}
+	enc := yaml.NewEncoder(b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(p.file, b.Bytes(), 0644)
+}
+
+// addDictNodes adds the entries of m missing from the key section of
+// root, and the missing languages to its existing entries
+func addDictNodes(root *yaml.Node, key string, m map[string]dictEntry) error {
+	var section *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			section = root.Content[i+1]
+		}
+	}
+	if section == nil {
+		if len(m) == 0 {
+			return nil
+		}
+		section = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, section)
+	}
+	if section.Kind == yaml.ScalarNode && section.Tag == "!!null" {
+		*section = yaml.Node{Kind: yaml.MappingNode}
+	}
+	if section.Kind != yaml.MappingNode {
+		return fmt.Errorf("dict %s is not a mapping", key)
+	}
+
+	exists := map[string]bool{}
+	for i := 0; i+1 < len(section.Content); i += 2 {
+		k, v := section.Content[i].Value, section.Content[i+1]
+		exists[k] = true
+		if v.Kind == yaml.MappingNode {
+			addLangNodes(v, m[k])
+		}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if !exists[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := &yaml.Node{}
+		if err := v.Encode(m[k].marshal()); err != nil {
+			return err
+		}
+		section.Content = append(section.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: k}, v)
+	}
+	return nil
+}
+
+// addLangNodes adds the languages of e missing from the mapping node
+func addLangNodes(node *yaml.Node, e dictEntry) {
+	exists := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		exists[node.Content[i].Value] = true
+	}
+
+	langs := make([]string, 0, len(e))
+	for lang := range e {
+		if lang == "" {
+			lang = dictDefaultLang
+		}
+		if !exists[lang] {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+
+	for _, lang := range langs {
+		s := e[lang]
+		if lang == dictDefaultLang {
+			s = e[""]
+		}
+		v := &yaml.Node{}
+		v.Encode(s)
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: lang}, v)
+	}
+}
+
+// saveText appends the missing global column entries to the legacy
+// file, table entries, per-table columns and languages are not
+// supported by it.
+func (p *dictionary) saveText() error {
+	old := newDictionary(p.file, p.lang)
+	old.parseText(p.raw)
+
+	keys := make([]string, 0, len(p.columns))
+	for k := range p.columns {
+		if _, ok := old.columns[k]; !ok && !strings.Contains(k, ".") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	b := bytes.NewBuffer(append([]byte{}, p.raw...))
+	if b.Len() > 0 && !bytes.HasSuffix(p.raw, []byte("\n")) {
+		b.WriteByte('\n')
+	}
+	for _, k := range keys {
+		s, _ := p.columns[k].get(p.lang)
+		fmt.Fprintf(b, "%s%s: %s\n", keyPrefix, k, s)
+	}
+
+	return ioutil.WriteFile(p.file, b.Bytes(), 0644)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yubo/gotool/mysqlschema"
+)
+
+var dictYaml = `
+tables:
+  user: {zh: 用户表, en: users}
+columns:
+  id: ID
+  name: {zh: 名称, en: name}
+  user.name: {zh: 用户名}
+`
+
+func TestDictLookup(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dict.yaml")
+	if err := ioutil.WriteFile(file, []byte(dictYaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		lang   string
+		table  string
+		column string
+		want   string
+		ok     bool
+	}{
+		{"zh", "user", "name", "用户名", true},
+		{"zh", "order", "name", "名称", true},
+		{"en", "user", "name", "name", true},
+		{"en", "user", "id", "ID", true},
+		{"", "user", "name", "", false},
+		{"zh", "user", "email", "", false},
+	}
+	for _, c := range cases {
+		dict, err := loadDict(file, c.lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok := dict.column(c.table, c.column)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s %s.%s got (%s, %v) want (%s, %v)", c.lang, c.table, c.column, got, ok, c.want, c.ok)
+		}
+	}
+
+	dict, _ := loadDict(file, "en")
+	if s, _ := dict.table("user"); s != "users" {
+		t.Errorf("table user got %s want users", s)
+	}
+}
+
+func TestDictText(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dict.txt")
+	if err := ioutil.WriteFile(file, []byte("name_version：版本\nname_hostname: 主机名\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := loadDict(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := dict.column("version", "version"); s != "版本" {
+		t.Errorf("version got %s", s)
+	}
+	if s, _ := dict.column("host", "hostname"); s != "主机名" {
+		t.Errorf("hostname got %s", s)
+	}
+
+	if _, err := loadDict(filepath.Join(t.TempDir(), "nonexistent.yaml"), ""); err != nil {
+		t.Errorf("nonexistent dict file should be empty, got %s", err)
+	}
+}
+
+func TestDictSync(t *testing.T) {
+	tab, err := mysqlschema.ParseTableSql("CREATE TABLE `user` (\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(128) NOT NULL DEFAULT '' COMMENT 'user name',\n" +
+		"  `created_at` int NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user, id, created_at; tables are not supported by the text format
+	for name, added := range map[string]int{"dict.yaml": 3, "dict.json": 3, "dict.txt": 2} {
+		file := filepath.Join(t.TempDir(), name)
+
+		var content string
+		for i, want := range []int{added, 0} {
+			dict, err := loadDict(file, "zh")
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := &schemaDoc{Tables: []*tableDoc{newTableDoc(tab, dict)}}
+			if added := dict.sync(doc, false); len(added) != want {
+				t.Errorf("%s round %d added %v want %d keys", name, i, added, want)
+			}
+			if err := dict.save(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, _ := ioutil.ReadFile(file)
+			if i > 0 && string(b) != content {
+				t.Errorf("%s changed after sync\n%s\n%s", name, content, b)
+			}
+			content = string(b)
+		}
+
+		if !strings.Contains(content, "created_at") || strings.Contains(content, "`name`") {
+			t.Errorf("%s unexpected content\n%s", name, content)
+		}
+	}
+}
+
+func TestDictSyncKeepsFile(t *testing.T) {
+	tab, err := mysqlschema.ParseTableSql("CREATE TABLE `user` (\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `url` varchar(128) NOT NULL DEFAULT '',\n" +
+		"  `name` varchar(128) NOT NULL DEFAULT '',\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"dict.txt",
+			"# user columns\nname_url: 地址: 例如 http\nname_id: ID",
+			[]string{"# user columns\nname_url: 地址: 例如 http\nname_id: ID\n", "name_name:"}},
+		{"dict.yaml",
+			"# user columns\ncolumns:\n  id: ID # primary key\n  name: {en: name}\n",
+			[]string{"# user columns\n", "id: ID # primary key\n", "name: {en: name, zh: ", "  url:\n    zh: "}},
+	}
+	for _, c := range cases {
+		file := filepath.Join(t.TempDir(), c.name)
+		if err := ioutil.WriteFile(file, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		dict, err := loadDict(file, "zh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := dict.column("user", "url"); c.name == "dict.txt" && s != "地址: 例如 http" {
+			t.Errorf("%s url got %s", c.name, s)
+		}
+
+		doc := &schemaDoc{Tables: []*tableDoc{newTableDoc(tab, dict)}}
+		dict.sync(doc, false)
+		if err := dict.save(); err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ := ioutil.ReadFile(file)
+		for _, want := range c.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("%s: want %q in\n%s", c.name, want, b)
+			}
+		}
+	}
+}
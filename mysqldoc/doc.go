@@ -2,24 +2,36 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/yubo/golib/orm"
+	"github.com/yubo/gotool/mysqlschema"
 )
 
-const keyPrefix = "name_"
-
 type Doc struct {
 	*Config
 	db   orm.DB
 	sqls []string
+	errs []*mysqlschema.TableError // skipped tables
 }
 
+// conn connects to the database unless the schema is read from a file
 func (p *Doc) conn() error {
+	if p.file != "" {
+		return nil
+	}
+	if p.dsn == "" {
+		return fmt.Errorf("one of --dsn or --file is required")
+	}
+
 	var err error
 	if p.db, err = orm.Open("mysql", p.Config.dsn); err != nil {
 		return err
@@ -28,148 +40,544 @@ func (p *Doc) conn() error {
 }
 
 func (p *Doc) close() error {
-	p.db.Close()
+	if p.db != nil {
+		p.db.Close()
+	}
 	return nil
 }
 
-func (p *Doc) loadDict() map[string]string {
-	dict := map[string]string{}
-	if p.dict != "" {
-		bytesRead, err := ioutil.ReadFile(p.dict)
-		if err != nil {
-			fmt.Printf("error opening file: %v\n", err)
-		}
-		for _, line := range strings.Split(string(bytesRead), "\n") {
-			line = strings.TrimSpace(line)
-			line = strings.TrimPrefix(line, keyPrefix)
-			line = strings.ReplaceAll(line, "：", ":")
-			if fs := strings.Split(line, ":"); len(fs) == 2 {
-				dict[fs[0]] = fs[1]
-			}
+// loadTables returns the tables of the sql file or the database, the
+// tables which could not be parsed are recorded in p.errs
+func (p *Doc) loadTables() ([]*mysqlschema.MysqlTable, error) {
+	p.errs = nil
+
+	var tables []*mysqlschema.MysqlTable
+	var err error
+	if p.file != "" {
+		tables, err = mysqlschema.ParseFile(p.file)
+	} else {
+		tables, err = mysqlschema.ParseTables(p.db)
+	}
+	return tables, p.skip(err)
+}
+
+// skip records the skipped tables of a ParseErrors, other errors are
+// returned as is
+func (p *Doc) skip(err error) error {
+	if errs, ok := err.(mysqlschema.ParseErrors); ok {
+		p.errs = append(p.errs, errs...)
+		return nil
+	}
+	return err
+}
+
+// schemaDoc builds the document model of the connected database
+func (p *Doc) schemaDoc(dict *dictionary) (*schemaDoc, error) {
+	tables, err := p.loadTables()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &schemaDoc{Name: p.dbName()}
+	for _, t := range tables {
+		if t.IsChild {
+			continue
+		}
+		doc.Tables = append(doc.Tables, newTableDoc(t, dict))
+	}
+	doc.linkTables()
+
+	if p.since != "" {
+		old, err := loadSource(p.since)
+		if err = p.skip(err); err != nil {
+			return nil, fmt.Errorf("load %s: %s", sourceName(p.since), err)
 		}
+		doc.Changelog = &changelogDoc{Since: sourceName(p.since), Changes: diffTables(old, tables)}
+	}
+
+	if (p.stats || p.sample > 0) && p.db == nil {
+		return nil, fmt.Errorf("--stats and --sample require --dsn")
 	}
-	return dict
+	if p.stats {
+		if err := p.loadStats(doc); err != nil {
+			return nil, err
+		}
+	}
+	if p.sample > 0 {
+		p.loadSamples(doc, p.sample, p.masks)
+	}
+
+	return doc, nil
 }
 
 func (p *Doc) dbDoc() error {
-	var tabs []string
-	if err := p.db.Query("show tables").Rows(&tabs); err != nil {
+	dict, err := loadDict(p.dict, p.lang)
+	if err != nil {
 		return err
 	}
 
-	dict1 := p.loadDict()
-	dict2 := map[string]string{}
-
-	for _, tab := range tabs {
-		p.tableDoc(tab, dict1, dict2)
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return err
 	}
 
-	if len(dict2) > 0 {
-		fd, err := os.OpenFile(p.dict, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if p.er != "" {
+		diagram, err := erDiagram(p.er, doc)
 		if err != nil {
 			return err
 		}
-		defer fd.Close()
+		doc.Diagram, doc.DiagramType = diagram, p.er
+	}
+
+	r, err := p.renderer()
+	if err != nil {
+		return err
+	}
+	if err := renderDoc(r, doc, p.out); err != nil {
+		return err
+	}
 
-		fmt.Fprintf(fd, "\n### miss dict\n")
-		for k, v := range dict2 {
-			fmt.Fprintf(fd, "%s%s: %s\n", keyPrefix, k, v)
+	if cols := doc.undescribed(); len(cols) > 0 {
+		fmt.Fprintf(os.Stderr, "\n\nThere are %d columns without description (no COMMENT nor dict entry):\n", len(cols))
+		for _, v := range cols {
+			fmt.Fprintf(os.Stderr, "  %s\n", v)
 		}
+		fmt.Fprintf(os.Stderr, "\nRun `mysqldoc dict sync` to add them to the dictionary file %s\n", p.dict)
+	}
+
+	return nil
+}
+
+// snapshot writes the parsed tables as json, to be used as --since
+// source later
+func (p *Doc) snapshot(out string) error {
+	tables, err := p.loadTables()
+	if err != nil {
+		return err
+	}
 
-		fmt.Printf("\n\nThere are %d keyword descriptions that were not found and have been added to the dictionary file %s\n", len(dict2), p.dict)
+	if out == "" {
+		return writeSnapshot(os.Stdout, tables)
 	}
 
+	fd, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if err := writeSnapshot(fd, tables); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// gen writes go structs, proto messages or json schemas of the tables
+func (p *Doc) gen(lang, pkg, out string) error {
+	dict, err := loadDict(p.dict, p.lang)
+	if err != nil {
+		return err
+	}
+
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		return genCode(os.Stdout, doc, lang, pkg)
+	}
+
+	fd, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if err := genCode(fd, doc, lang, pkg); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// site writes the static documentation site into dir
+func (p *Doc) site(dir string) error {
+	dict, err := loadDict(p.dict, p.lang)
+	if err != nil {
+		return err
+	}
+
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSite(doc, dir); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d tables have been written to %s\n", len(doc.Tables), dir)
 	return nil
 }
 
-func (p *Doc) tableDoc(tab string, dict1, dict2 map[string]string) error {
-	d, err := parseTable(p.db, tab)
+// serve serves the documentation over http until it fails
+func (p *Doc) serve(listen string, refresh time.Duration) error {
+	s := newServer(p, refresh)
+
+	// load once to fail fast on bad dsn or dict
+	if _, err := s.schema(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Listening %s ...\n", listen)
+	return http.ListenAndServe(listen, s.handler())
+}
+
+// writeTableErrors prints the skipped tables along with their DDL
+func writeTableErrors(w io.Writer, errs []*mysqlschema.TableError) {
+	fmt.Fprintf(w, "\n%d tables skipped because of errors, the output is incomplete:\n", len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(w, "\n  %s\n", e)
+		if e.Sql == "" {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(e.Sql), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
+
+// lint checks the documentation coverage, it returns an error if the
+// coverage is below the threshold
+func (p *Doc) lint(opts *lintOptions, out string) error {
+	dict, err := loadDict(p.dict, p.lang)
 	if err != nil {
 		return err
 	}
-	if d.IsChild {
+
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return err
+	}
+
+	ret := lintDoc(doc, opts)
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		fd, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		w = fd
+	}
+	if err := ret.write(w, opts.format); err != nil {
+		return err
+	}
+
+	if !ret.Passed {
+		return fmt.Errorf("documentation coverage %.2f%% is below %.2f%%, %d tables/columns without description",
+			ret.Coverage, ret.MinCoverage, len(ret.Missing))
+	}
+	return nil
+}
+
+// dictSync adds the missing descriptions to the dictionary file
+func (p *Doc) dictSync(perTable bool) error {
+	dict, err := loadDict(p.dict, p.lang)
+	if err != nil {
+		return err
+	}
+	if perTable && !dict.structured() {
+		return fmt.Errorf("--per-table requires a yaml or json dictionary file")
+	}
+
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return err
+	}
+
+	added := dict.sync(doc, perTable)
+	if len(added) == 0 {
+		fmt.Fprintf(os.Stderr, "The dictionary file %s is up to date\n", p.dict)
 		return nil
 	}
 
-	printTableDoc(d, dict1, dict2)
+	if err := dict.save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "There are %d keyword descriptions that were not found and have been added to the dictionary file %s\n", len(added), p.dict)
 	return nil
 }
 
+// undescribed returns table.column of the columns that have neither
+// a dict entry nor a COMMENT
+func (p *schemaDoc) undescribed() []string {
+	var ret []string
+	for _, t := range p.Tables {
+		for _, f := range t.Fields {
+			if f.DescFrom == descFromName {
+				ret = append(ret, t.Name+"."+f.Name)
+			}
+		}
+	}
+	return ret
+}
+
+func (p *Doc) renderer() (Renderer, error) {
+	if p.template != "" {
+		return newFileTemplateRenderer(p.template)
+	}
+	return newRenderer(p.format)
+}
+
+func (p *Doc) dbName() string {
+	if p.file != "" && p.file != "-" {
+		base := filepath.Base(p.file)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if cf, err := mysql.ParseDSN(p.dsn); err == nil && cf.DBName != "" {
+		return cf.DBName
+	}
+	return "mysqldoc"
+}
+
 var (
-	commentRe  = regexp.MustCompile(`COMMENT='(\S+)'\s*`)
+	commentRe  = regexp.MustCompile(`COMMENT\s*=\s*'((?:[^'\\]|\\.|'')*)'`)
 	notnullRe  = regexp.MustCompile(`(NOT NULL)`)
-	comment2Re = regexp.MustCompile(`COMMENT '(\S+)'\s*`)
-	defaultRe  = regexp.MustCompile(`DEFAULT\s+(\S+)\s*`)
+	comment2Re = regexp.MustCompile(`COMMENT\s+'((?:[^'\\]|\\.|'')*)'`)
+	defaultRe  = regexp.MustCompile(`DEFAULT\s+('(?:[^'\\]|\\.|'')*'|\S+)`)
 	typeRe     = regexp.MustCompile(`^(\S+(\s+unsigned)?)\s*`)
+	charsetRe  = regexp.MustCompile(`CHARSET\s*=\s*(\S+)`)
+	autoIncRe  = regexp.MustCompile(`AUTO_INCREMENT`)
 )
 
-type fieldDoc struct {
-	name    string
-	typ     string
-	def     string
-	comment string
+// schemaDoc is the document model shared by all renderers and templates
+type schemaDoc struct {
+	Name        string        `json:"name"`
+	Tables      []*tableDoc   `json:"tables"`
+	Diagram     string        `json:"diagram,omitempty"`     // ER diagram source
+	DiagramType string        `json:"diagramType,omitempty"` // mermaid, plantuml or dot
+	Changelog   *changelogDoc `json:"changelog,omitempty"`
 }
 
 type tableDoc struct {
-	comment string
-	fields  map[string]string
+	Name    string      `json:"name"`
+	Comment string      `json:"comment,omitempty"`
+	Desc    string      `json:"desc,omitempty"`
+	Engine  string      `json:"engine,omitempty"`
+	Charset string      `json:"charset,omitempty"`
+	Options string      `json:"options,omitempty"` // raw table options after ENGINE=
+	Fields  []*fieldDoc `json:"fields"`
+	Keys    []*keyDoc   `json:"keys,omitempty"`
+
+	ForeignKeys  []*foreignKeyDoc `json:"foreignKeys,omitempty"`
+	ReferencedBy []*foreignKeyDoc `json:"referencedBy,omitempty"` // foreign keys of other tables that reference this table
+
+	Stats   *tableStats `json:"stats,omitempty"`   // --stats
+	Samples *sampleDoc  `json:"samples,omitempty"` // --sample
+}
+
+type fieldDoc struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Nullable      bool   `json:"nullable"`
+	Default       string `json:"default,omitempty"` // sql literal, e.g. '0', NULL, CURRENT_TIMESTAMP
+	AutoIncrement bool   `json:"autoIncrement,omitempty"`
+	Comment       string `json:"comment,omitempty"`
+	Key           string `json:"key,omitempty"` // PRI, UNI or MUL, like information_schema.COLUMNS.COLUMN_KEY
+	Definition    string `json:"definition"`    // raw column definition
+	Desc          string `json:"desc"`
+	DescFrom      string `json:"descFrom"`           // dict, comment or name
+	RefTable      string `json:"refTable,omitempty"` // set if the column is a foreign key
+	RefField      string `json:"refField,omitempty"`
 }
 
-func printTableDoc(t *MysqlTable, dict1, dict2 map[string]string) {
-	//var comment string
-	//if m := commentRe.FindStringSubmatch(t.Engine.Desc); len(m) == 2 {
-	//	comment = m[1]
-	//}
+const (
+	descFromDict    = "dict"
+	descFromComment = "comment"
+	descFromName    = "name"
+)
+
+type keyDoc struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Fields []string `json:"fields"`
+}
+
+type foreignKeyDoc struct {
+	Name      string   `json:"name"`
+	Table     string   `json:"table"`
+	Fields    []string `json:"fields"`
+	RefTable  string   `json:"refTable"`
+	RefFields []string `json:"refFields"`
+	OnDelete  string   `json:"onDelete,omitempty"`
+	OnUpdate  string   `json:"onUpdate,omitempty"`
+}
+
+func newTableDoc(t *mysqlschema.MysqlTable, dict *dictionary) *tableDoc {
+	doc := &tableDoc{
+		Name:    t.Name,
+		Engine:  t.Engine.Name,
+		Options: t.Engine.Desc,
+		Fields:  make([]*fieldDoc, 0, len(t.Fields)),
+		Keys:    make([]*keyDoc, 0, len(t.Keys)),
+	}
+	if m := commentRe.FindStringSubmatch(t.Engine.Desc); len(m) == 2 {
+		doc.Comment = unquote(m[1])
+	}
+	doc.Desc = doc.Comment
+	if s, ok := dict.table(t.Name); ok {
+		doc.Desc = s
+	}
+	if m := charsetRe.FindStringSubmatch(t.Engine.Desc); len(m) == 2 {
+		doc.Charset = m[1]
+	}
+
+	fieldKeys := map[string]string{}
+	for _, v := range t.Keys {
+		k := &keyDoc{Name: v.Name, Type: v.Type, Fields: splitKeyFields(v.Fields)}
+		doc.Keys = append(doc.Keys, k)
+
+		for i, name := range k.Fields {
+			name = strings.SplitN(name, "(", 2)[0]
+			switch {
+			case k.Type == "PRIMARY KEY":
+				fieldKeys[name] = "PRI"
+			case i > 0 || fieldKeys[name] != "":
+			case k.Type == "UNIQUE KEY" && len(k.Fields) == 1:
+				fieldKeys[name] = "UNI"
+			default:
+				fieldKeys[name] = "MUL"
+			}
+		}
+	}
 
-	fmt.Printf("\n\n#### 表名 %s\n", t.Name)
-	//if len(comment) > 0 {
-	//	fmt.Printf("%s\n\n", comment)
-	//}
+	fieldRefs := map[string][2]string{}
+	for _, v := range t.ForeignKeys {
+		fk := &foreignKeyDoc{
+			Name:      v.Name,
+			Table:     t.Name,
+			Fields:    splitKeyFields(v.Fields),
+			RefTable:  v.RefTable,
+			RefFields: splitKeyFields(v.RefFields),
+			OnDelete:  v.OnDelete,
+			OnUpdate:  v.OnUpdate,
+		}
+		doc.ForeignKeys = append(doc.ForeignKeys, fk)
 
-	//fmt.Printf("序号 | 字段名 | 类型 | 允许空 | 缺省值 | 备注\n")
-	fmt.Printf("序号 | 名称 | 数据类型 | 允许空值 | 说明\n")
-	fmt.Printf("-- | -- | -- | -- | --\n")
-	for i, v := range t.Fields {
-		var notnull bool
-		if m := notnullRe.FindStringSubmatch(v.Desc); len(m) == 2 {
-			notnull = true
+		for i, name := range fk.Fields {
+			if i < len(fk.RefFields) {
+				fieldRefs[name] = [2]string{fk.RefTable, fk.RefFields[i]}
+			}
 		}
+	}
 
-		//var comment string
-		//if m := comment2Re.FindStringSubmatch(v.Desc); len(m) == 2 {
-		//	comment = m[1]
-		//}
+	for _, v := range t.Fields {
+		f := &fieldDoc{
+			Name:          v.Name,
+			Nullable:      !notnullRe.MatchString(v.Desc),
+			AutoIncrement: autoIncRe.MatchString(v.Desc),
+			Key:           fieldKeys[v.Name],
+			Definition:    v.Desc,
+			RefTable:      fieldRefs[v.Name][0],
+			RefField:      fieldRefs[v.Name][1],
+		}
 
-		var typ string
 		if m := typeRe.FindStringSubmatch(v.Desc); len(m) >= 2 {
-			typ = m[1]
+			f.Type = m[1]
+		}
+		if m := comment2Re.FindStringSubmatch(v.Desc); len(m) == 2 {
+			f.Comment = unquote(m[1])
+		}
+		if m := defaultRe.FindStringSubmatch(v.Desc); len(m) == 2 {
+			f.Default = m[1]
 		}
 
-		//def := "-"
-		//if m := defaultRe.FindStringSubmatch(v.Desc); len(m) == 2 {
-		//	def = m[1]
-		//}
-		desc := strings.ReplaceAll(v.Name, "_", " ")
-		if s, ok := dict1[v.Name]; ok {
-			desc = s
+		// description precedence: dict > COMMENT > column name
+		if s, ok := dict.column(t.Name, v.Name); ok {
+			f.Desc, f.DescFrom = s, descFromDict
+		} else if f.Comment != "" {
+			f.Desc, f.DescFrom = f.Comment, descFromComment
 		} else {
-			dict2[v.Name] = desc
+			f.Desc, f.DescFrom = strings.ReplaceAll(v.Name, "_", " "), descFromName
+		}
+
+		doc.Fields = append(doc.Fields, f)
+	}
+
+	return doc
+}
+
+// table returns the table named name, nil if not found
+func (p *schemaDoc) table(name string) *tableDoc {
+	for _, t := range p.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// linkTables fills ReferencedBy from the foreign keys of all tables
+func (p *schemaDoc) linkTables() {
+	tables := make(map[string]*tableDoc, len(p.Tables))
+	for _, t := range p.Tables {
+		tables[t.Name] = t
+	}
+
+	for _, t := range p.Tables {
+		for _, fk := range t.ForeignKeys {
+			if ref, ok := tables[fk.RefTable]; ok {
+				ref.ReferencedBy = append(ref.ReferencedBy, fk)
+			}
 		}
+	}
+}
 
-		fmt.Printf("%d | %s | %s | %v | %s\n",
-			i+1, v.Name, typ, !notnull, desc)
+// splitKeyFields splits "`a`,`b`(10)" into [a b(10)]
+func splitKeyFields(s string) []string {
+	var fields []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.ReplaceAll(v, "`", ""); v != "" {
+			fields = append(fields, v)
+		}
 	}
+	return fields
+}
 
-	//fmt.Printf("\n索引\n\n")
+// unquote resolves the escapes of a single quoted sql string body
+func unquote(s string) string {
+	return strings.NewReplacer(`''`, `'`, `\'`, `'`, `\\`, `\`, `\n`, "\n").Replace(s)
+}
+
+// matchColumn reports whether table.column matches one of the patterns,
+// e.g. "*.email", "users.phone", a pattern without "." matches the
+// column of all tables
+func matchColumn(patterns []string, table, column string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, ".") {
+			pattern = "*." + pattern
+		}
+		if ok, _ := path.Match(pattern, table+"."+column); ok {
+			return true
+		}
+	}
+	return false
+}
 
-	//fmt.Printf("序号 | 索引名 | 类型 | 字段名\n")
-	//fmt.Printf("-- | -- | -- | --\n")
-	//for i, v := range t.Keys {
-	//	name := "-"
-	//	if len(v.Name) > 0 {
-	//		name = v.Name
-	//	}
-	//	fmt.Printf("%d | %s | %s | %s\n",
-	//		i, name, v.Type, v.Fields)
-	//}
+// matchTable reports whether one of the patterns matches the whole
+// table, e.g. "tmp_*.*"
+func matchTable(patterns []string, table string) bool {
+	for _, pattern := range patterns {
+		i := strings.LastIndex(pattern, ".")
+		if i < 0 || pattern[i+1:] != "*" {
+			continue
+		}
+		if ok, _ := path.Match(pattern[:i], table); ok {
+			return true
+		}
+	}
+	return false
 }
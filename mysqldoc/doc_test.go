@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/yubo/gotool/mysqlschema"
 )
 
 var jsonContext = []byte(`
@@ -89,13 +95,345 @@ var jsonContext = []byte(`
 }
 `)
 
-func TestPrintDoc(t *testing.T) {
-	tab := &MysqlTable{}
+func TestRender(t *testing.T) {
+	tab := &mysqlschema.MysqlTable{}
+	if err := json.Unmarshal(jsonContext, tab); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &schemaDoc{Name: "test", Tables: []*tableDoc{newTableDoc(tab, nil)}}
+
+	for _, format := range []string{"markdown", "html", "asciidoc", "json", "csv"} {
+		r, err := newRenderer(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := &bytes.Buffer{}
+		if err := r.Render(buf, doc); err != nil {
+			t.Fatalf("%s: %s", format, err)
+		}
+		if !strings.Contains(buf.String(), "display_name") {
+			t.Errorf("%s: field display_name not found in\n%s", format, buf.String())
+		}
+	}
+
+	if _, err := newRenderer("pdf"); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	tab := &mysqlschema.MysqlTable{}
+	if err := json.Unmarshal(jsonContext, tab); err != nil {
+		t.Fatal(err)
+	}
+
+	dict := newDictionary("", "")
+	dict.columns["id"] = dictEntry{"": "ID"}
+	dict.columns["name"] = dictEntry{"": "name|nick"}
+	doc := &schemaDoc{Tables: []*tableDoc{newTableDoc(tab, dict)}}
+
+	r, _ := newRenderer("markdown")
+	buf := &bytes.Buffer{}
+	if err := r.Render(buf, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"#### 表名 user\n",
+		"1 | id | bigint(20) unsigned | false | ID\n",
+		"| name\\|nick\n",
+		"10 | extra | blob | true | extra\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRenderCell(t *testing.T) {
+	tab := &mysqlschema.MysqlTable{}
+	if err := json.Unmarshal(jsonContext, tab); err != nil {
+		t.Fatal(err)
+	}
+
+	dict := newDictionary("", "")
+	dict.columns["name"] = dictEntry{"": "a|b\nc\rd"}
+	doc := &schemaDoc{Name: "test", Tables: []*tableDoc{newTableDoc(tab, dict)}}
+
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"markdown", " | a\\|b c d\n"},
+		{"asciidoc", " |a\\|b c d\n"},
+	}
+	for _, c := range cases {
+		r, _ := newRenderer(c.format)
+		buf := &bytes.Buffer{}
+		if err := r.Render(buf, doc); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), c.want) {
+			t.Errorf("%s: want %q in\n%s", c.format, c.want, buf.String())
+		}
+	}
+}
+
+func TestRenderDir(t *testing.T) {
+	tab := &mysqlschema.MysqlTable{}
 	if err := json.Unmarshal(jsonContext, tab); err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+
+	doc := &schemaDoc{
+		Name:        "test",
+		Tables:      []*tableDoc{newTableDoc(tab, nil)},
+		Diagram:     "erDiagram\n",
+		DiagramType: "mermaid",
+		Changelog:   &changelogDoc{Since: "old.sql", Changes: []*changeDoc{{Table: "user", Type: "addTable"}}},
+	}
+
+	r, _ := newRenderer("markdown")
+	out := t.TempDir() + "/"
+	if err := renderDoc(r, doc, out); err != nil {
+		t.Fatal(err)
 	}
 
-	dict := map[string]string{}
+	b, err := ioutil.ReadFile(filepath.Join(out, "index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"erDiagram", "old.sql"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %q in index.md\n%s", want, b)
+		}
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(out, "user.md")); err != nil || !strings.Contains(string(b), "display_name") {
+		t.Errorf("user.md: %s\n%s", err, b)
+	}
+
+	r, _ = newRenderer("csv")
+	if err := renderDoc(r, doc, out); err == nil {
+		t.Errorf("expected error for --er with csv")
+	}
+}
+
+func TestNewTableDoc(t *testing.T) {
+	tab, err := mysqlschema.ParseTableSql("CREATE TABLE `user` (\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+		"  `name` varchar(128) NOT NULL DEFAULT 'it''s' COMMENT 'user name, unique',\n" +
+		"  `extra` blob,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `index_name` (`name`)\n" +
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='user table';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTableDoc(tab, nil)
+	if d.Comment != "user table" || d.Engine != "InnoDB" || d.Charset != "utf8mb4" {
+		t.Errorf("unexpected table %+v", d)
+	}
+	if len(d.Keys) != 2 || d.Keys[1].Name != "index_name" || d.Keys[1].Fields[0] != "name" {
+		t.Errorf("unexpected keys %+v", d.Keys)
+	}
+
+	want := []fieldDoc{
+		{Name: "id", Type: "bigint(20) unsigned", AutoIncrement: true, Key: "PRI"},
+		{Name: "name", Type: "varchar(128)", Default: "'it''s'", Comment: "user name, unique", Key: "UNI"},
+		{Name: "extra", Type: "blob", Nullable: true},
+	}
+	for i, w := range want {
+		f := d.Fields[i]
+		if f.Name != w.Name || f.Type != w.Type || f.Nullable != w.Nullable ||
+			f.Default != w.Default || f.Comment != w.Comment || f.Key != w.Key ||
+			f.AutoIncrement != w.AutoIncrement {
+			t.Errorf("field %d got %+v want %+v", i, f, w)
+		}
+	}
+}
+
+func TestFileTemplate(t *testing.T) {
+	tab := &mysqlschema.MysqlTable{}
+	if err := json.Unmarshal(jsonContext, tab); err != nil {
+		t.Fatal(err)
+	}
+	doc := &schemaDoc{Name: "test", Tables: []*tableDoc{newTableDoc(tab, nil)}}
 
-	printTableDoc(tab, dict, dict)
+	r, err := newFileTemplateRenderer("./examples/full.md.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Ext() != ".md" {
+		t.Errorf("ext got %s want .md", r.Ext())
+	}
+
+	buf := &bytes.Buffer{}
+	if err := r.Render(buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"## user - user\n",
+		"1 | id | bigint(20) unsigned | NO | - | PRI | id\n",
+		"index_name | UNIQUE KEY | name\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want %q in\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestDescPrecedence(t *testing.T) {
+	tab, err := mysqlschema.ParseTableSql("CREATE TABLE `user` (\n" +
+		"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'primary id',\n" +
+		"  `name` varchar(128) NOT NULL DEFAULT '' COMMENT 'user name',\n" +
+		"  `created_at` int NOT NULL,\n" +
+		"  PRIMARY KEY (`id`)\n" +
+		") ENGINE=InnoDB;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dict := newDictionary("", "")
+	dict.columns["id"] = dictEntry{"": "ID"}
+	doc := &schemaDoc{Tables: []*tableDoc{newTableDoc(tab, dict)}}
+
+	want := [][2]string{
+		{"ID", descFromDict},
+		{"user name", descFromComment},
+		{"created at", descFromName},
+	}
+	for i, w := range want {
+		if f := doc.Tables[0].Fields[i]; f.Desc != w[0] || f.DescFrom != w[1] {
+			t.Errorf("field %s got (%s, %s) want %v", f.Name, f.Desc, f.DescFrom, w)
+		}
+	}
+
+	if cols := doc.undescribed(); len(cols) != 1 || cols[0] != "user.created_at" {
+		t.Errorf("undescribed got %v", cols)
+	}
+}
+
+func TestForeignKeyAndER(t *testing.T) {
+	sqls := []string{
+		"CREATE TABLE `user` (\n" +
+			"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `name` varchar(128) NOT NULL DEFAULT '',\n" +
+			"  PRIMARY KEY (`id`)\n" +
+			") ENGINE=InnoDB;",
+		"CREATE TABLE `order` (\n" +
+			"  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT,\n" +
+			"  `user_id` bigint(20) unsigned NOT NULL,\n" +
+			"  PRIMARY KEY (`id`),\n" +
+			"  KEY `fk_order_user` (`user_id`),\n" +
+			"  CONSTRAINT `fk_order_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE ON UPDATE NO ACTION\n" +
+			") ENGINE=InnoDB;",
+	}
+
+	doc := &schemaDoc{Name: "test"}
+	for _, sql := range sqls {
+		tab, err := mysqlschema.ParseTableSql(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc.Tables = append(doc.Tables, newTableDoc(tab, nil))
+	}
+	doc.linkTables()
+
+	order := doc.Tables[1]
+	if len(order.Keys) != 2 || len(order.ForeignKeys) != 1 {
+		t.Fatalf("unexpected keys %v foreign keys %v", order.Keys, order.ForeignKeys)
+	}
+	fk := order.ForeignKeys[0]
+	if fk.Name != "fk_order_user" || fk.RefTable != "user" || fk.RefFields[0] != "id" ||
+		fk.OnDelete != "CASCADE" || fk.OnUpdate != "NO ACTION" {
+		t.Errorf("unexpected foreign key %+v", fk)
+	}
+	if f := order.Fields[1]; f.RefTable != "user" || f.RefField != "id" {
+		t.Errorf("unexpected field ref %+v", f)
+	}
+	if refs := doc.Tables[0].ReferencedBy; len(refs) != 1 || refs[0].Table != "order" {
+		t.Errorf("unexpected referenced by %v", refs)
+	}
+
+	for typ, want := range map[string]string{
+		"mermaid":  "order }o--|| user : \"user_id\"",
+		"plantuml": "order }o--|| user",
+		"dot":      "\"order\" -> \"user\" [label=\"user_id\"];",
+	} {
+		s, err := erDiagram(typ, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(s, want) {
+			t.Errorf("%s: want %q in\n%s", typ, want, s)
+		}
+	}
+
+	if _, err := erDiagram("svg", doc); err == nil {
+		t.Errorf("expected error for unsupported diagram type")
+	}
+}
+
+// testSchemaDoc returns the document of testdata/schema.sql
+func testSchemaDoc(t *testing.T) *schemaDoc {
+	p := &Doc{Config: &Config{file: "./testdata/schema.sql"}}
+	if err := p.conn(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.close()
+
+	doc, err := p.schemaDoc(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestDocFromFile(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	if doc.Name != "schema" {
+		t.Errorf("name got %s want schema", doc.Name)
+	}
+
+	var names []string
+	for _, t := range doc.Tables {
+		names = append(names, t.Name)
+	}
+	if got := strings.Join(names, ","); got != "user,order,user_log" {
+		t.Errorf("tables got %s", got)
+	}
+
+	if refs := doc.Tables[0].ReferencedBy; len(refs) != 1 || refs[0].Table != "order" {
+		t.Errorf("unexpected referenced by %v", refs)
+	}
+}
+
+func TestDocPartial(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "doc.md")
+	cf := &Config{file: "./testdata/schema_partial.sql", format: "markdown", out: out}
+
+	err := mysqldoc(cf, func(p *Doc) error {
+		if err := p.dbDoc(); err != nil {
+			return err
+		}
+		if len(p.errs) != 1 || p.errs[0].Table != "metric" || !strings.Contains(p.errs[0].Sql, "PARTITION BY") {
+			t.Errorf("unexpected errors %v", p.errs)
+		}
+		return nil
+	})
+	if e, ok := err.(*partialError); !ok || e.n != 1 {
+		t.Fatalf("expected partial error, got %v", err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "表名 user") || strings.Contains(string(b), "metric") {
+		t.Errorf("unexpected output\n%s", b)
+	}
 }
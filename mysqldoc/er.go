@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	identRe   = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	baseTypRe = regexp.MustCompile(`^[A-Za-z]+`)
+)
+
+// erDiagram generates the entity-relationship diagram source of doc
+func erDiagram(typ string, doc *schemaDoc) (string, error) {
+	b := &strings.Builder{}
+
+	switch typ {
+	case "mermaid":
+		mermaidER(b, doc)
+	case "plantuml":
+		plantumlER(b, doc)
+	case "dot":
+		dotER(b, doc)
+	default:
+		return "", fmt.Errorf("unsupported er diagram type %q", typ)
+	}
+
+	return b.String(), nil
+}
+
+func erIdent(s string) string {
+	return identRe.ReplaceAllString(s, "_")
+}
+
+// erKeys returns the mermaid style key flags, e.g. "PK,FK"
+func erKeys(f *fieldDoc) string {
+	var keys []string
+	switch f.Key {
+	case "PRI":
+		keys = append(keys, "PK")
+	case "UNI":
+		keys = append(keys, "UK")
+	}
+	if f.RefTable != "" {
+		keys = append(keys, "FK")
+	}
+	return strings.Join(keys, ",")
+}
+
+func mermaidER(b *strings.Builder, doc *schemaDoc) {
+	b.WriteString("erDiagram\n")
+	for _, t := range doc.Tables {
+		fmt.Fprintf(b, "    %s {\n", erIdent(t.Name))
+		for _, f := range t.Fields {
+			fmt.Fprintf(b, "        %s %s", baseTypRe.FindString(f.Type), erIdent(f.Name))
+			if keys := erKeys(f); keys != "" {
+				fmt.Fprintf(b, " %s", keys)
+			}
+			if f.Desc != "" {
+				fmt.Fprintf(b, " %q", strings.ReplaceAll(f.Desc, `"`, `'`))
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("    }\n")
+	}
+
+	for _, t := range doc.Tables {
+		for _, fk := range t.ForeignKeys {
+			fmt.Fprintf(b, "    %s }o--|| %s : %q\n", erIdent(t.Name), erIdent(fk.RefTable), strings.Join(fk.Fields, ","))
+		}
+	}
+}
+
+func plantumlER(b *strings.Builder, doc *schemaDoc) {
+	b.WriteString("@startuml\nhide circle\nskinparam linetype ortho\n\n")
+	for _, t := range doc.Tables {
+		fmt.Fprintf(b, "entity %q as %s {\n", t.Name, erIdent(t.Name))
+		for _, f := range t.Fields {
+			mark := ""
+			if !f.Nullable {
+				mark = "* "
+			}
+			fmt.Fprintf(b, "  %s%s : %s", mark, f.Name, f.Type)
+			if keys := erKeys(f); keys != "" {
+				fmt.Fprintf(b, " <<%s>>", keys)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+	}
+
+	for _, t := range doc.Tables {
+		for _, fk := range t.ForeignKeys {
+			fmt.Fprintf(b, "%s }o--|| %s\n", erIdent(t.Name), erIdent(fk.RefTable))
+		}
+	}
+	b.WriteString("@enduml\n")
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "|", `\|`, "<", `\<`, ">", `\>`)
+
+func dotER(b *strings.Builder, doc *schemaDoc) {
+	b.WriteString("digraph schema {\n  rankdir=LR;\n  node [shape=record, fontsize=10];\n\n")
+	for _, t := range doc.Tables {
+		fields := make([]string, 0, len(t.Fields))
+		for _, f := range t.Fields {
+			s := f.Name + " : " + f.Type
+			if keys := erKeys(f); keys != "" {
+				s += " (" + keys + ")"
+			}
+			fields = append(fields, dotEscaper.Replace(s)+`\l`)
+		}
+		fmt.Fprintf(b, "  %q [label=\"{%s|%s}\"];\n", t.Name, dotEscaper.Replace(t.Name), strings.Join(fields, ""))
+	}
+
+	b.WriteString("\n")
+	for _, t := range doc.Tables {
+		for _, fk := range t.ForeignKeys {
+			fmt.Fprintf(b, "  %q -> %q [label=%q];\n", t.Name, fk.RefTable, strings.Join(fk.Fields, ","))
+		}
+	}
+	b.WriteString("}\n")
+}
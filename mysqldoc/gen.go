@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// genFile is the model of a generated go or proto file
+type genFile struct {
+	Package string
+	Imports []string
+	Structs []*genStruct
+}
+
+type genStruct struct {
+	Name    string // CamelCase table name
+	Table   string
+	Comment string
+	Fields  []*genField
+}
+
+type genField struct {
+	Name     string // CamelCase column name
+	Column   string // proto field name
+	Type     string
+	Tag      string // go struct tag
+	Optional bool   // nullable proto field
+	Number   int    // proto field number
+	Comment  string
+}
+
+// goInitialisms are upper cased in go names, e.g. user_id -> UserID
+var goInitialisms = map[string]bool{
+	"api": true, "html": true, "http": true, "id": true, "ip": true, "json": true,
+	"sql": true, "uid": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// genCode writes go structs, proto messages, JSON Schema or OpenAPI
+// schemas of the tables of doc
+func genCode(w io.Writer, doc *schemaDoc, lang, pkg string) error {
+	switch lang {
+	case "go":
+		if pkg == "" {
+			pkg = "model"
+		}
+		return genGo(w, newGenFile(doc, pkg, goType, goImport))
+	case "proto":
+		if pkg == "" {
+			pkg = strings.ToLower(genIdent(doc.Name))
+		}
+		return genTpl.ExecuteTemplate(w, "proto", newGenFile(doc, pkg, protoType, protoImport))
+	case "jsonschema":
+		return writeJsonSchema(w, doc)
+	case "openapi":
+		return writeOpenapi(w, doc)
+	default:
+		return fmt.Errorf("unsupported gen format %q", lang)
+	}
+}
+
+func newGenFile(doc *schemaDoc, pkg string, typeFn func(*fieldDoc) (string, bool), importFn func(string) string) *genFile {
+	f := &genFile{Package: pkg}
+	imports := map[string]bool{}
+
+	for _, t := range doc.Tables {
+		s := &genStruct{Name: goName(t.Name), Table: t.Name, Comment: genComment(t.Desc)}
+		for i, v := range t.Fields {
+			typ, optional := typeFn(v)
+			if imp := importFn(typ); imp != "" {
+				imports[imp] = true
+			}
+
+			tag := v.Name
+			if v.Key == "PRI" {
+				tag += ",where"
+			}
+			comment := ""
+			if v.DescFrom != descFromName {
+				comment = genComment(v.Desc)
+			}
+
+			s.Fields = append(s.Fields, &genField{
+				Name:     goName(v.Name),
+				Column:   genIdent(v.Name),
+				Type:     typ,
+				Tag:      fmt.Sprintf(`sql:"%s" json:"%s"`, tag, v.Name),
+				Optional: optional,
+				Number:   i + 1,
+				Comment:  comment,
+			})
+		}
+		f.Structs = append(f.Structs, s)
+	}
+
+	for k := range imports {
+		f.Imports = append(f.Imports, k)
+	}
+	sort.Strings(f.Imports)
+
+	return f
+}
+
+func genGo(w io.Writer, f *genFile) error {
+	var buf bytes.Buffer
+	if err := genTpl.ExecuteTemplate(&buf, "go", f); err != nil {
+		return err
+	}
+
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// sqlType returns the lower cased type name without length and the
+// unsigned attribute, e.g. "bigint unsigned" -> "bigint", true
+func sqlType(typ string) (string, bool) {
+	typ = strings.ToLower(typ)
+	unsigned := strings.Contains(typ, "unsigned")
+	if i := strings.IndexAny(typ, "( "); i >= 0 {
+		typ = typ[:i]
+	}
+	return typ, unsigned
+}
+
+// goType maps the column type, nullable columns are pointers
+func goType(f *fieldDoc) (string, bool) {
+	typ, unsigned := sqlType(f.Type)
+
+	var t string
+	switch typ {
+	case "tinyint":
+		t = "int8"
+	case "smallint", "year":
+		t = "int16"
+	case "mediumint", "int", "integer":
+		t = "int32"
+	case "bigint":
+		t = "int64"
+	case "bit":
+		t, unsigned = "int64", true
+	case "float":
+		t = "float32"
+	case "double", "real", "decimal", "numeric":
+		t = "float64"
+	case "date", "datetime", "timestamp":
+		t = "time.Time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "[]byte", false
+	default:
+		t = "string"
+	}
+	if unsigned && strings.HasPrefix(t, "int") {
+		t = "u" + t
+	}
+	if f.Nullable {
+		t = "*" + t
+	}
+	return t, f.Nullable
+}
+
+func goImport(typ string) string {
+	if strings.Contains(typ, "time.Time") {
+		return "time"
+	}
+	return ""
+}
+
+// protoType maps the column type, nullable columns are optional
+func protoType(f *fieldDoc) (string, bool) {
+	typ, unsigned := sqlType(f.Type)
+
+	var t string
+	switch typ {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "year":
+		t = "int32"
+	case "bigint":
+		t = "int64"
+	case "bit":
+		t, unsigned = "int64", true
+	case "float":
+		t = "float"
+	case "double", "real", "decimal", "numeric":
+		t = "double"
+	case "date", "datetime", "timestamp":
+		// messages have presence already
+		return "google.protobuf.Timestamp", false
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		t = "bytes"
+	default:
+		t = "string"
+	}
+	if unsigned && strings.HasPrefix(t, "int") {
+		t = "u" + t
+	}
+	return t, f.Nullable
+}
+
+func protoImport(typ string) string {
+	if typ == "google.protobuf.Timestamp" {
+		return "google/protobuf/timestamp.proto"
+	}
+	return ""
+}
+
+// goName converts a snake_case name to an exported go name,
+// e.g. user_id -> UserID
+func goName(s string) string {
+	var b strings.Builder
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if goInitialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(strings.ToUpper(string(r[0])) + string(r[1:]))
+	}
+
+	name := b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// genIdent replaces the characters not allowed in identifiers with "_"
+func genIdent(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// genComment makes s fit in a single line comment
+func genComment(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+var genTpl = template.Must(template.New("gen").Parse(`
+{{- define "go" -}}
+// Code generated by mysqldoc gen. DO NOT EDIT.
+
+package {{.Package}}
+{{if .Imports}}
+import (
+{{range .Imports}}	"{{.}}"
+{{end}})
+{{end}}{{range .Structs}}
+// {{.Name}} {{if .Comment}}{{.Comment}}{{else}}is a row of the table {{.Table}}{{end}}
+type {{.Name}} struct {
+{{range .Fields}}	{{.Name}} {{.Type}} ` + "`{{.Tag}}`" + `{{if .Comment}} // {{.Comment}}{{end}}
+{{end}}}
+{{end}}
+{{- end}}
+
+{{- define "proto" -}}
+// Code generated by mysqldoc gen. DO NOT EDIT.
+
+syntax = "proto3";
+
+package {{.Package}};
+{{if .Imports}}
+{{range .Imports}}import "{{.}}";
+{{end}}{{end}}{{range .Structs}}
+// {{.Name}} {{if .Comment}}{{.Comment}}{{else}}is a row of the table {{.Table}}{{end}}
+message {{.Name}} {
+{{range .Fields}}{{if .Comment}}  // {{.Comment}}
+{{end}}  {{if .Optional}}optional {{end}}{{.Type}} {{.Column}} = {{.Number}};
+{{end}}}
+{{end}}
+{{- end}}
+`))
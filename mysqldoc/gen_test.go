@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGoName(t *testing.T) {
+	cases := map[string]string{
+		"user_id":    "UserID",
+		"user_log":   "UserLog",
+		"created_at": "CreatedAt",
+		"api_url":    "APIURL",
+		"1st":        "X1st",
+	}
+	for in, want := range cases {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%s) got %s want %s", in, got, want)
+		}
+	}
+}
+
+func TestGenCode(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	cases := []struct {
+		lang string
+		pkg  string
+		want []string
+	}{{
+		lang: "go",
+		want: []string{
+			"package model\n",
+			"import (\n\t\"time\"\n)",
+			"// User users\ntype User struct {",
+			"\tID        uint64    `sql:\"id,where\" json:\"id\"` // user id\n",
+			"\tPhone     *string   `sql:\"phone\" json:\"phone\"`\n",
+			"\tCreatedAt time.Time `sql:\"created_at\" json:\"created_at\"`\n",
+			"\tAmount float64 `sql:\"amount\" json:\"amount\"`\n",
+			"// UserLog is a row of the table user_log\n",
+		},
+	}, {
+		lang: "proto",
+		pkg:  "test.v1",
+		want: []string{
+			"syntax = \"proto3\";\n\npackage test.v1;\n",
+			"import \"google/protobuf/timestamp.proto\";\n",
+			"message User {\n  // user id\n  uint64 id = 1;\n",
+			"  optional string phone = 4;\n",
+			"  google.protobuf.Timestamp created_at = 6;\n",
+			"  double amount = 3;\n",
+		},
+	}}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := genCode(&buf, doc, c.lang, c.pkg); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range c.want {
+			if !strings.Contains(buf.String(), s) {
+				t.Errorf("%s output missing %q:\n%s", c.lang, s, buf.String())
+			}
+		}
+	}
+
+	if err := genCode(&bytes.Buffer{}, doc, "rust", ""); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
@@ -6,4 +6,9 @@ require (
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/spf13/cobra v1.4.0
 	github.com/yubo/golib v0.0.1
+	github.com/yubo/gotool/mysqlschema v0.1.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
+
+// the local copy until mysqlschema/v0.1.0 is published
+replace github.com/yubo/gotool/mysqlschema => ../mysqlschema
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	lengthRe = regexp.MustCompile(`^\w+\((\d+)\)`)
+	enumRe   = regexp.MustCompile(`(?i)^(enum|set)\s*\(`)
+)
+
+// jsonSchema is a JSON Schema (draft 2020-12) object, which is also
+// an OpenAPI 3.1 schema object
+type jsonSchema struct {
+	Schema          string        `json:"$schema,omitempty" yaml:"$schema,omitempty"`
+	Title           string        `json:"title,omitempty" yaml:"title,omitempty"`
+	Description     string        `json:"description,omitempty" yaml:"description,omitempty"`
+	Type            interface{}   `json:"type,omitempty" yaml:"type,omitempty"` // "string" or ["string", "null"]
+	Format          string        `json:"format,omitempty" yaml:"format,omitempty"`
+	ContentEncoding string        `json:"contentEncoding,omitempty" yaml:"contentEncoding,omitempty"`
+	Enum            []interface{} `json:"enum,omitempty" yaml:"enum,omitempty"`
+	MaxLength       int           `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Minimum         *int          `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Items           *jsonSchema   `json:"items,omitempty" yaml:"items,omitempty"`
+	UniqueItems     bool          `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+	ReadOnly        bool          `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	Properties      schemaMap     `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required        []string      `json:"required,omitempty" yaml:"required,omitempty"`
+	Defs            schemaMap     `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+}
+
+// schemaMap is a map of schemas keeping the insertion order
+type schemaMap []schemaItem
+
+type schemaItem struct {
+	Name   string
+	Schema *jsonSchema
+}
+
+func (p schemaMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, v := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(v.Name)
+		if err != nil {
+			return nil, err
+		}
+		s, err := json.Marshal(v.Schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(s)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (p schemaMap) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range p {
+		value := &yaml.Node{}
+		if err := value.Encode(v.Schema); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: v.Name}, value)
+	}
+	return node, nil
+}
+
+// writeJsonSchema writes the tables as a JSON Schema with one $defs
+// entry per table
+func writeJsonSchema(w io.Writer, doc *schemaDoc) error {
+	s := &jsonSchema{
+		Schema: jsonSchemaDraft,
+		Title:  doc.Name,
+		Defs:   tableSchemas(doc),
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// writeOpenapi writes the tables as an OpenAPI 3.1 components.schemas
+// section in yaml
+func writeOpenapi(w io.Writer, doc *schemaDoc) error {
+	var s struct {
+		Components struct {
+			Schemas schemaMap `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	s.Components.Schemas = tableSchemas(doc)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&s); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func tableSchemas(doc *schemaDoc) schemaMap {
+	ret := make(schemaMap, 0, len(doc.Tables))
+	for _, t := range doc.Tables {
+		ret = append(ret, schemaItem{Name: goName(t.Name), Schema: tableSchema(t)})
+	}
+	return ret
+}
+
+func tableSchema(t *tableDoc) *jsonSchema {
+	s := &jsonSchema{
+		Title:       t.Name,
+		Description: genComment(t.Desc),
+		Type:        "object",
+		Required:    []string{},
+	}
+
+	for _, f := range t.Fields {
+		s.Properties = append(s.Properties, schemaItem{Name: f.Name, Schema: columnSchema(f)})
+		if !f.Nullable {
+			s.Required = append(s.Required, f.Name)
+		}
+	}
+
+	return s
+}
+
+func columnSchema(f *fieldDoc) *jsonSchema {
+	s := &jsonSchema{ReadOnly: f.AutoIncrement}
+	if f.DescFrom != descFromName {
+		s.Description = genComment(f.Desc)
+	}
+
+	typ, unsigned := sqlType(f.Type)
+	switch typ {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		s.Type = "integer"
+		if typ == "bigint" {
+			s.Format = "int64"
+		} else if typ != "bit" {
+			s.Format = "int32"
+		}
+		if unsigned {
+			zero := 0
+			s.Minimum = &zero
+		}
+	case "float":
+		s.Type, s.Format = "number", "float"
+	case "double", "real", "decimal", "numeric":
+		s.Type, s.Format = "number", "double"
+	case "date":
+		s.Type, s.Format = "string", "date"
+	case "datetime", "timestamp":
+		s.Type, s.Format = "string", "date-time"
+	case "time":
+		s.Type, s.Format = "string", "time"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		s.Type, s.ContentEncoding = "string", "base64"
+	case "enum":
+		s.Type = "string"
+		for _, v := range enumValues(f.Definition) {
+			s.Enum = append(s.Enum, v)
+		}
+	case "set":
+		s.Type = "array"
+		s.UniqueItems = true
+		s.Items = &jsonSchema{Type: "string"}
+		for _, v := range enumValues(f.Definition) {
+			s.Items.Enum = append(s.Items.Enum, v)
+		}
+	case "json":
+		// any json value
+	default:
+		s.Type = "string"
+		if typ == "char" || typ == "varchar" {
+			if m := lengthRe.FindStringSubmatch(f.Type); len(m) == 2 {
+				s.MaxLength, _ = strconv.Atoi(m[1])
+			}
+		}
+	}
+
+	if f.Nullable && s.Type != nil {
+		s.Type = []string{s.Type.(string), "null"}
+		if s.Enum != nil {
+			s.Enum = append(s.Enum, nil)
+		}
+	}
+
+	return s
+}
+
+// enumValues returns the values of an enum or set column definition,
+// e.g. "enum('a','b') NOT NULL" -> [a b]
+func enumValues(def string) []string {
+	loc := enumRe.FindStringIndex(def)
+	if loc == nil {
+		return nil
+	}
+
+	var values []string
+	var b strings.Builder
+	quoted := false
+	for i := loc[1]; i < len(def); i++ {
+		c := def[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(def):
+			i++
+			b.WriteByte(def[i])
+		case quoted && c == '\'' && i+1 < len(def) && def[i+1] == '\'':
+			i++
+			b.WriteByte(c)
+		case c == '\'':
+			if quoted {
+				values = append(values, b.String())
+				b.Reset()
+			}
+			quoted = !quoted
+		case quoted:
+			b.WriteByte(c)
+		case c == ')':
+			return values
+		}
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yubo/gotool/mysqlschema"
+	"gopkg.in/yaml.v3"
+)
+
+func TestEnumValues(t *testing.T) {
+	cases := map[string][]string{
+		"enum('active','disabled') NOT NULL DEFAULT 'active'": {"active", "disabled"},
+		"set('a b','it''s','x,y') DEFAULT NULL":               {"a b", "it's", "x,y"},
+		"varchar(16) DEFAULT NULL":                            nil,
+	}
+	for def, want := range cases {
+		if got := enumValues(def); !reflect.DeepEqual(got, want) {
+			t.Errorf("enumValues(%s) got %q want %q", def, got, want)
+		}
+	}
+}
+
+func TestColumnSchema(t *testing.T) {
+	cases := []struct {
+		def  string
+		want string
+	}{
+		{"`a` int unsigned NOT NULL,", `{"type":"integer","format":"int32","minimum":0}`},
+		{"`a` varchar(32) DEFAULT NULL COMMENT 'x',", `{"description":"x","type":["string","null"],"maxLength":32}`},
+		{"`a` enum('on','off') DEFAULT NULL,", `{"type":["string","null"],"enum":["on","off",null]}`},
+		{"`a` set('r','w') NOT NULL,", `{"type":"array","items":{"type":"string","enum":["r","w"]},"uniqueItems":true}`},
+		{"`a` blob,", `{"type":["string","null"],"contentEncoding":"base64"}`},
+		{"`a` json NOT NULL,", `{}`},
+	}
+	for _, c := range cases {
+		tab, err := mysqlschema.ParseTableSql("CREATE TABLE `t` (\n  " + c.def + "\n  PRIMARY KEY (`a`)\n) ENGINE=InnoDB;")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := json.Marshal(columnSchema(newTableDoc(tab, nil).Fields[0]))
+		if string(b) != c.want {
+			t.Errorf("%s got %s want %s", c.def, b, c.want)
+		}
+	}
+}
+
+func TestGenJsonSchema(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	var buf bytes.Buffer
+	if err := genCode(&buf, doc, "jsonschema", ""); err != nil {
+		t.Fatal(err)
+	}
+	s := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s["$schema"] != jsonSchemaDraft {
+		t.Errorf("unexpected $schema %v", s["$schema"])
+	}
+	defs := s["$defs"].(map[string]interface{})
+	if len(defs) != 3 || defs["UserLog"] == nil {
+		t.Errorf("unexpected $defs %v", defs)
+	}
+	// properties keep the column order
+	if i, j := strings.Index(buf.String(), `"phone"`), strings.Index(buf.String(), `"status"`); i < 0 || i > j {
+		t.Errorf("unexpected properties order")
+	}
+
+	buf.Reset()
+	if err := genCode(&buf, doc, "openapi", ""); err != nil {
+		t.Fatal(err)
+	}
+	o := map[string]map[string]map[string]interface{}{}
+	if err := yaml.Unmarshal(buf.Bytes(), &o); err != nil {
+		t.Fatal(err)
+	}
+	if schemas := o["components"]["schemas"]; len(schemas) != 3 || schemas["Order"] == nil {
+		t.Errorf("unexpected components.schemas %v", schemas)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type lintOptions struct {
+	minCoverage float64 // percent
+	ignores     []string
+	tableDesc   bool // also require table descriptions
+	format      string
+}
+
+type lintIssue struct {
+	Table  string `json:"table"`
+	Column string `json:"column,omitempty"`
+}
+
+type lintResult struct {
+	Database    string      `json:"database"`
+	Checked     int         `json:"checked"`
+	Described   int         `json:"described"`
+	Coverage    float64     `json:"coverage"`
+	MinCoverage float64     `json:"minCoverage"`
+	Passed      bool        `json:"passed"`
+	Missing     []lintIssue `json:"missing"`
+
+	cases []lintIssue // all checked items, for junit
+}
+
+// lintDoc checks that every table and column of doc has a description,
+// from a COMMENT or the dictionary
+func lintDoc(doc *schemaDoc, opts *lintOptions) *lintResult {
+	ret := &lintResult{
+		Database:    doc.Name,
+		MinCoverage: opts.minCoverage,
+		Missing:     []lintIssue{},
+	}
+
+	check := func(issue lintIssue, described bool) {
+		ret.Checked++
+		ret.cases = append(ret.cases, issue)
+		if described {
+			ret.Described++
+		} else {
+			ret.Missing = append(ret.Missing, issue)
+		}
+	}
+
+	for _, t := range doc.Tables {
+		if opts.tableDesc && !matchTable(opts.ignores, t.Name) {
+			check(lintIssue{Table: t.Name}, t.Desc != "")
+		}
+		for _, f := range t.Fields {
+			if !matchColumn(opts.ignores, t.Name, f.Name) {
+				check(lintIssue{Table: t.Name, Column: f.Name}, f.DescFrom != descFromName)
+			}
+		}
+	}
+
+	ret.Coverage = 100
+	if ret.Checked > 0 {
+		ret.Coverage = float64(ret.Described) * 100 / float64(ret.Checked)
+	}
+	ret.Passed = ret.Coverage >= opts.minCoverage
+
+	return ret
+}
+
+func (p *lintResult) write(w io.Writer, format string) error {
+	switch format {
+	case "", "text":
+		return p.writeText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case "junit":
+		return p.writeJunit(w)
+	default:
+		return fmt.Errorf("unsupported lint output %q", format)
+	}
+}
+
+func (p *lintResult) writeText(w io.Writer) error {
+	for _, v := range p.Missing {
+		if v.Column == "" {
+			fmt.Fprintf(w, "%s: missing table description\n", v.Table)
+		} else {
+			fmt.Fprintf(w, "%s.%s: missing column description\n", v.Table, v.Column)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d/%d described, coverage %.2f%%, required %.2f%%\n",
+		p.Described, p.Checked, p.Coverage, p.MinCoverage)
+	return err
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+func (p *lintResult) writeJunit(w io.Writer) error {
+	missing := make(map[lintIssue]bool, len(p.Missing))
+	for _, v := range p.Missing {
+		missing[v] = true
+	}
+
+	suite := &junitTestSuite{
+		Name:     "mysqldoc." + p.Database,
+		Tests:    len(p.cases),
+		Failures: len(p.Missing),
+	}
+	for _, v := range p.cases {
+		c := junitTestCase{ClassName: p.Database + "." + v.Table, Name: v.Column}
+		if v.Column == "" {
+			c.ClassName, c.Name = p.Database, v.Table
+		}
+		if missing[v] {
+			c.Failure = &junitFailure{Message: "missing description"}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
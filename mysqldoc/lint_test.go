@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	cases := []struct {
+		opts      lintOptions
+		checked   int
+		described int
+		passed    bool
+	}{
+		{lintOptions{minCoverage: 100, tableDesc: true}, 16, 5, false},
+		{lintOptions{minCoverage: 30, tableDesc: true}, 16, 5, true},
+		{lintOptions{minCoverage: 100}, 13, 4, false},
+		{lintOptions{minCoverage: 40, tableDesc: true, ignores: []string{"*.id", "user_log.*"}}, 10, 4, true},
+	}
+	for i, c := range cases {
+		ret := lintDoc(doc, &c.opts)
+		if ret.Checked != c.checked || ret.Described != c.described || ret.Passed != c.passed {
+			t.Errorf("case %d got %d/%d passed %v want %d/%d passed %v", i,
+				ret.Described, ret.Checked, ret.Passed, c.described, c.checked, c.passed)
+		}
+	}
+}
+
+func TestLintOutput(t *testing.T) {
+	ret := lintDoc(testSchemaDoc(t), &lintOptions{minCoverage: 100, tableDesc: true, ignores: []string{"user_log.*"}})
+
+	var buf bytes.Buffer
+	if err := ret.write(&buf, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"order: missing table description", "user.email: missing column description"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("text output missing %q:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := ret.write(&buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	got := lintResult{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Passed || len(got.Missing) != len(ret.Missing) {
+		t.Errorf("unexpected json result %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := ret.write(&buf, "junit"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`<testsuite name="mysqldoc.schema" tests="12" failures="7">`,
+		`<testcase classname="schema.user" name="id"></testcase>`,
+		`<testcase classname="schema" name="order">`} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("junit output missing %q:\n%s", s, buf.String())
+		}
+	}
+
+	if err := ret.write(&buf, "xml"); err == nil {
+		t.Errorf("expected error for unsupported output")
+	}
+}
+
+func TestLintAfterSync(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dict.yaml")
+	p := &Doc{Config: &Config{file: "./testdata/schema.sql", dict: file}}
+	if err := p.dictSync(false); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := loadDict(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dict.tables) == 0 || len(dict.columns) == 0 {
+		t.Fatalf("nothing synced to %s", file)
+	}
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the synced entries are empty, they don't count as descriptions
+	ret := lintDoc(doc, &lintOptions{minCoverage: 100, tableDesc: true})
+	if ret.Checked != 16 || ret.Described != 5 {
+		t.Errorf("got %d/%d want 5/16 described", ret.Described, ret.Checked)
+	}
+}
@@ -6,15 +6,27 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
-// usage: mysqldoc --dsn="root:1234@tcp(localhost:3306)/src_db?charset=utf8" --dict ./dict.txt
+// usage: mysqldoc --dsn="root:1234@tcp(localhost:3306)/src_db?charset=utf8" --dict ./dict.txt --format html --out ./db.html
+//        mysqldump --no-data src_db | mysqldoc --file - --dict ./dict.txt
 
 type Config struct {
-	dsn  string
-	dict string
+	dsn      string
+	file     string
+	dict     string
+	lang     string
+	stats    bool
+	sample   int
+	masks    []string
+	since    string
+	format   string
+	template string
+	out      string
+	er       string
 }
 
 func main() {
@@ -22,31 +34,185 @@ func main() {
 	var rootCmd = &cobra.Command{
 		Use:   "mysqldoc",
 		Short: "mysqldoc is a tool that generate MySQL database documents",
+		// errors are printed to stderr by main
+		SilenceErrors: true,
+		// errors after the flags are parsed are not usage errors
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			cmd.SilenceUsage = true
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return mysqldoc(cf)
+			return mysqldoc(cf, func(p *Doc) error { return p.dbDoc() })
 		},
 	}
 
 	fs := rootCmd.PersistentFlags()
 	fs.StringVar(&cf.dsn, "dsn", "", "dsn e.g. root:1234@tcp(localhost:3306)/src_db?charset=utf8")
-	fs.StringVar(&cf.dict, "dict", "./dict.txt", "e.g. ./dict.txt")
+	fs.StringVar(&cf.file, "file", "", "read the schema from a sql file instead of the database, e.g. the output of mysqldump --no-data, \"-\" for stdin")
+	fs.StringVar(&cf.dict, "dict", "./dict.txt", "dictionary file, e.g. ./dict.txt, ./dict.yaml, ./dict.json")
+	fs.StringVar(&cf.lang, "lang", "", "language of the dictionary descriptions, e.g. zh, en")
+	fs.BoolVar(&cf.stats, "stats", false, "add table statistics (rows, data/index size, auto increment, update time)")
+	fs.IntVar(&cf.sample, "sample", 0, "add up to N sample rows per table")
+	fs.StringSliceVar(&cf.masks, "mask", nil, "mask sample columns matching table.column patterns, e.g. *.email,users.phone")
+	fs.StringVar(&cf.since, "since", "", "older version of the schema to list the changes since, a dsn, sql file or snapshot .json")
+
+	fs = rootCmd.Flags()
+	fs.StringVarP(&cf.format, "format", "f", "markdown", "output format, one of markdown|html|asciidoc|json|csv")
+	fs.StringVarP(&cf.template, "template", "t", "", "go template file used to render the document, overrides --format")
+	fs.StringVar(&cf.er, "er", "", "embed an entity-relationship diagram, one of mermaid|plantuml|dot")
+	fs.StringVarP(&cf.out, "out", "o", "", "output file, or a directory to write one file per table (default stdout)")
+
+	rootCmd.AddCommand(
+		newDictCmd(cf),
+		newSiteCmd(cf),
+		newServeCmd(cf),
+		newLintCmd(cf),
+		newSnapshotCmd(cf),
+		newGenCmd(cf),
+	)
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		if _, ok := err.(*partialError); ok {
+			os.Exit(exitPartial)
+		}
 		os.Exit(1)
 	}
 }
 
-func mysqldoc(cf *Config) error {
+func newDictCmd(cf *Config) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dict",
+		Short: "manage the dictionary file",
+	}
+
+	var perTable bool
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "add the missing table and column descriptions to the dictionary file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.dictSync(perTable) })
+		},
+	}
+	syncCmd.Flags().BoolVar(&perTable, "per-table", false, "add columns as table.column instead of global entries")
+
+	cmd.AddCommand(syncCmd)
+	return cmd
+}
+
+func newSiteCmd(cf *Config) *cobra.Command {
+	var dir string
+	cmd := &cobra.Command{
+		Use:   "site",
+		Short: "generate a static documentation site with one page per table",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.site(dir) })
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "out", "o", "./docs", "output directory")
+
+	return cmd
+}
+
+func newServeCmd(cf *Config) *cobra.Command {
+	var listen string
+	var refresh time.Duration
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "serve the documentation of the live schema over http",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.serve(listen, refresh) })
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":8080", "listen address")
+	cmd.Flags().DurationVar(&refresh, "refresh", 5*time.Minute, "reload the schema when the cached one is older than this")
+
+	return cmd
+}
+
+func newLintCmd(cf *Config) *cobra.Command {
+	opts := &lintOptions{}
+	var out string
+	cmd := &cobra.Command{
+		Use:          "lint",
+		Short:        "check that tables and columns are documented, exits non-zero below the threshold",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.lint(opts, out) })
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.Float64Var(&opts.minCoverage, "min-coverage", 100, "minimum percentage of described tables/columns")
+	fs.StringSliceVar(&opts.ignores, "ignore", nil, "table.column patterns to skip, e.g. *.id,*.created_at,tmp_*.*")
+	fs.BoolVar(&opts.tableDesc, "tables", true, "also require table descriptions")
+	fs.StringVar(&opts.format, "output", "text", "report format, one of text|json|junit")
+	fs.StringVarP(&out, "out", "o", "", "report file (default stdout)")
+
+	return cmd
+}
+
+func newSnapshotCmd(cf *Config) *cobra.Command {
+	var out string
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "save the parsed schema as json, to be compared later with --since",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.snapshot(out) })
+		},
+	}
+
+	cmd.Flags().StringVarP(&out, "out", "o", "", "snapshot file, e.g. ./schema-v1.json (default stdout)")
+
+	return cmd
+}
+
+func newGenCmd(cf *Config) *cobra.Command {
+	var lang, pkg, out string
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "generate go structs, protobuf messages or json schemas of the tables",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return mysqldoc(cf, func(p *Doc) error { return p.gen(lang, pkg, out) })
+		},
+	}
+
+	fs := cmd.Flags()
+	fs.StringVarP(&lang, "format", "f", "go", "output format, one of go|proto|jsonschema|openapi")
+	fs.StringVar(&pkg, "package", "", "package name (default model for go, the database name for proto)")
+	fs.StringVarP(&out, "out", "o", "", "output file (default stdout)")
+
+	return cmd
+}
+
+// mysqldoc runs fn with a connected Doc, if some tables were skipped
+// they are reported and a *partialError is returned
+func mysqldoc(cf *Config, fn func(p *Doc) error) error {
 	p := &Doc{Config: cf}
 	if err := p.conn(); err != nil {
 		return err
 	}
 	defer p.close()
 
-	if err := p.dbDoc(); err != nil {
+	err := fn(p)
+	if len(p.errs) > 0 {
+		writeTableErrors(os.Stderr, p.errs)
+	}
+	if err != nil {
 		return err
 	}
-
+	if len(p.errs) > 0 {
+		return &partialError{n: len(p.errs)}
+	}
 	return nil
 }
+
+// exitPartial is the exit code when some tables were skipped
+const exitPartial = 2
+
+type partialError struct {
+	n int
+}
+
+func (p *partialError) Error() string {
+	return fmt.Sprintf("%d tables skipped, the output is incomplete", p.n)
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Renderer writes a schema document in a specific output format
+type Renderer interface {
+	Render(w io.Writer, doc *schemaDoc) error
+	// Ext returns the file extension used when writing to a directory
+	Ext() string
+}
+
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// cellReplacer escapes a value written in a markdown or asciidoc table
+// cell, line breaks would end the row
+var cellReplacer = strings.NewReplacer("|", `\|`, "\r\n", " ", "\r", " ", "\n", " ")
+
+var tplFuncs = template.FuncMap{
+	"inc":     func(i int) int { return i + 1 },
+	"cell":    cellReplacer.Replace,
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"size":    humanSize,
+	"change":  changeName,
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+func newRenderer(format string) (Renderer, error) {
+	switch strings.ToLower(format) {
+	case "markdown", "md":
+		return newTextRenderer(".md", markdownTpl), nil
+	case "html":
+		return newHtmlRenderer(".html", htmlTpl), nil
+	case "asciidoc", "adoc":
+		return newTextRenderer(".adoc", asciidocTpl), nil
+	case "json":
+		return &jsonRenderer{}, nil
+	case "csv":
+		return &csvRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// renderDoc renders doc to stdout when out is empty, to one file per
+// table when out is a directory, or to the file out otherwise.
+// In a directory the ER diagram and the changelog are written to
+// index.<ext>
+func renderDoc(r Renderer, doc *schemaDoc, out string) error {
+	if _, ok := r.(*csvRenderer); ok && (doc.Diagram != "" || doc.Changelog != nil) {
+		return fmt.Errorf("--er and --since are not supported by the csv format")
+	}
+
+	if out == "" {
+		return r.Render(os.Stdout, doc)
+	}
+
+	if fi, err := os.Stat(out); (err == nil && fi.IsDir()) || strings.HasSuffix(out, "/") {
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return err
+		}
+		if doc.Diagram != "" || doc.Changelog != nil {
+			for _, t := range doc.Tables {
+				if t.Name == indexName {
+					return fmt.Errorf("table %s conflicts with the index file of --er and --since", t.Name)
+				}
+			}
+			index := &schemaDoc{Name: doc.Name, Diagram: doc.Diagram, DiagramType: doc.DiagramType, Changelog: doc.Changelog}
+			if err := renderFile(r, index, filepath.Join(out, indexName+r.Ext())); err != nil {
+				return err
+			}
+		}
+		for _, t := range doc.Tables {
+			sub := &schemaDoc{Name: doc.Name, Tables: []*tableDoc{t}}
+			if err := renderFile(r, sub, filepath.Join(out, t.Name+r.Ext())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return renderFile(r, doc, out)
+}
+
+func renderFile(r Renderer, doc *schemaDoc, file string) error {
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if err := r.Render(fd, doc); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// indexName is the file name of the ER diagram and the changelog when
+// rendering to a directory
+const indexName = "index"
+
+type templateRenderer struct {
+	ext string
+	tpl executor
+}
+
+func newTextRenderer(ext, text string) *templateRenderer {
+	return &templateRenderer{
+		ext: ext,
+		tpl: template.Must(template.New(ext).Funcs(tplFuncs).Parse(text)),
+	}
+}
+
+func newHtmlRenderer(ext, text string) *templateRenderer {
+	return &templateRenderer{
+		ext: ext,
+		tpl: htmltemplate.Must(htmltemplate.Must(htmltemplate.New(ext).
+			Funcs(htmltemplate.FuncMap(tplFuncs)).Parse(text)).Parse(htmlBlocksTpl)),
+	}
+}
+
+// newFileTemplateRenderer loads a user supplied go template, the
+// template is executed with *schemaDoc as data.
+// The output file extension is taken from the template name,
+// e.g. "doc.md.tmpl" -> ".md"
+func newFileTemplateRenderer(file string) (*templateRenderer, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file), ".tmpl")
+	ext := filepath.Ext(base)
+	if ext == "" {
+		ext = ".txt"
+	}
+
+	tpl, err := template.New(filepath.Base(file)).Funcs(tplFuncs).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateRenderer{ext: ext, tpl: tpl}, nil
+}
+
+func (p *templateRenderer) Ext() string { return p.ext }
+
+func (p *templateRenderer) Render(w io.Writer, doc *schemaDoc) error {
+	return p.tpl.Execute(w, doc)
+}
+
+type jsonRenderer struct{}
+
+func (p *jsonRenderer) Ext() string { return ".json" }
+
+func (p *jsonRenderer) Render(w io.Writer, doc *schemaDoc) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// csvRenderer writes one row per column, prefixed with an utf-8 BOM
+// so that Excel/Word detect the encoding when importing.
+type csvRenderer struct{}
+
+func (p *csvRenderer) Ext() string { return ".csv" }
+
+func (p *csvRenderer) Render(w io.Writer, doc *schemaDoc) error {
+	if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"表名", "序号", "名称", "数据类型", "允许空值", "说明"})
+	for _, t := range doc.Tables {
+		for i, f := range t.Fields {
+			cw.Write([]string{t.Name, strconv.Itoa(i + 1), f.Name, f.Type, strconv.FormatBool(f.Nullable), f.Desc})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+const markdownTpl = `{{with .Changelog}}
+
+#### 变更记录
+
+自 {{.Since}} 以来
+{{if .Changes}}
+序号 | 表名 | 变更 | 名称 | 变更前 | 变更后
+-- | -- | -- | -- | -- | --
+{{range $i, $c := .Changes}}{{inc $i}} | {{cell $c.Table}} | {{change $c.Type}} | {{cell ($c.Name | default "-")}} | {{cell ($c.From | default "-")}} | {{cell ($c.To | default "-")}}
+{{end}}{{else}}
+无变更
+{{end}}{{end}}{{if .Diagram}}
+
+#### ER 图
+
+` + "```" + `{{.DiagramType}}
+{{.Diagram}}` + "```" + `
+{{end}}{{range .Tables}}
+
+#### 表名 {{.Name}}
+{{if .Desc}}{{.Desc}}
+
+{{end}}序号 | 名称 | 数据类型 | 允许空值 | 说明
+-- | -- | -- | -- | --
+{{range $i, $f := .Fields}}{{inc $i}} | {{cell $f.Name}} | {{cell $f.Type}} | {{$f.Nullable}} | {{cell $f.Desc}}
+{{end}}{{if .Keys}}
+索引
+
+序号 | 索引名 | 类型 | 字段名
+-- | -- | -- | --
+{{range $i, $k := .Keys}}{{inc $i}} | {{cell ($k.Name | default "-")}} | {{$k.Type}} | {{cell (join $k.Fields ", ")}}
+{{end}}{{end}}{{if .ForeignKeys}}
+外键
+
+序号 | 外键名 | 字段名 | 引用表 | 引用字段 | ON DELETE | ON UPDATE
+-- | -- | -- | -- | -- | -- | --
+{{range $i, $k := .ForeignKeys}}{{inc $i}} | {{cell ($k.Name | default "-")}} | {{cell (join $k.Fields ", ")}} | {{cell $k.RefTable}} | {{cell (join $k.RefFields ", ")}} | {{$k.OnDelete | default "-"}} | {{$k.OnUpdate | default "-"}}
+{{end}}{{end}}{{if .ReferencedBy}}
+被引用
+
+序号 | 表名 | 字段名 | 引用字段
+-- | -- | -- | --
+{{range $i, $k := .ReferencedBy}}{{inc $i}} | {{cell $k.Table}} | {{cell (join $k.Fields ", ")}} | {{cell (join $k.RefFields ", ")}}
+{{end}}{{end}}{{with .Stats}}
+统计
+
+行数(估算) | 数据大小 | 索引大小 | 自增值 | 更新时间
+-- | -- | -- | -- | --
+{{.Rows}} | {{size .DataLength}} | {{size .IndexLength}} | {{.AutoIncrement}} | {{.UpdateTime | default "-"}}
+{{end}}{{with .Samples}}
+样例数据
+
+{{range $i, $c := .Columns}}{{if $i}} | {{end}}{{cell $c}}{{end}}
+{{range $i, $c := .Columns}}{{if $i}} | {{end}}--{{end}}
+{{range .Rows}}{{range $i, $v := .}}{{if $i}} | {{end}}{{cell $v}}{{end}}
+{{end}}{{end}}{{end}}`
+
+const asciidocTpl = `= {{.Name}}
+:toc:
+{{with .Changelog}}
+== 变更记录
+
+自 {{.Since}} 以来
+{{if .Changes}}
+[options="header"]
+|===
+|序号 |表名 |变更 |名称 |变更前 |变更后
+{{range $i, $c := .Changes}}|{{inc $i}} |{{cell $c.Table}} |{{change $c.Type}} |{{cell ($c.Name | default "-")}} |{{cell ($c.From | default "-")}} |{{cell ($c.To | default "-")}}
+{{end}}|===
+{{else}}
+无变更
+{{end}}{{end}}{{if .Diagram}}
+== ER 图
+
+[{{if eq .DiagramType "dot"}}graphviz{{else}}{{.DiagramType}}{{end}}]
+....
+{{.Diagram}}....
+{{end}}{{range .Tables}}
+[[{{.Name}}]]
+== 表名 {{.Name}}
+{{if .Desc}}
+{{.Desc}}
+{{end}}
+[options="header"]
+|===
+|序号 |名称 |数据类型 |允许空值 |说明
+{{range $i, $f := .Fields}}|{{inc $i}} |{{cell $f.Name}} |{{cell $f.Type}} |{{$f.Nullable}} |{{cell $f.Desc}}
+{{end}}|===
+{{if .Keys}}
+.索引
+[options="header"]
+|===
+|序号 |索引名 |类型 |字段名
+{{range $i, $k := .Keys}}|{{inc $i}} |{{cell ($k.Name | default "-")}} |{{$k.Type}} |{{cell (join $k.Fields ", ")}}
+{{end}}|===
+{{end}}{{if .ForeignKeys}}
+.外键
+[options="header"]
+|===
+|序号 |外键名 |字段名 |引用表 |引用字段 |ON DELETE |ON UPDATE
+{{range $i, $k := .ForeignKeys}}|{{inc $i}} |{{cell ($k.Name | default "-")}} |{{cell (join $k.Fields ", ")}} |<<{{$k.RefTable}}>> |{{cell (join $k.RefFields ", ")}} |{{$k.OnDelete | default "-"}} |{{$k.OnUpdate | default "-"}}
+{{end}}|===
+{{end}}{{if .ReferencedBy}}
+.被引用
+[options="header"]
+|===
+|序号 |表名 |字段名 |引用字段
+{{range $i, $k := .ReferencedBy}}|{{inc $i}} |<<{{$k.Table}}>> |{{cell (join $k.Fields ", ")}} |{{cell (join $k.RefFields ", ")}}
+{{end}}|===
+{{end}}{{with .Stats}}
+.统计
+[options="header"]
+|===
+|行数(估算) |数据大小 |索引大小 |自增值 |更新时间
+|{{.Rows}} |{{size .DataLength}} |{{size .IndexLength}} |{{.AutoIncrement}} |{{.UpdateTime | default "-"}}
+|===
+{{end}}{{with .Samples}}
+.样例数据
+[options="header"]
+|===
+{{range .Columns}}|{{cell .}} {{end}}
+{{range .Rows}}{{range .}}|{{cell .}} {{end}}
+{{end}}|===
+{{end}}{{end}}`
+
+const htmlTpl = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f3f3f3; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<ul class="toc">
+{{- range .Tables}}
+<li><a href="#{{.Name}}">{{.Name}}</a></li>
+{{- end}}
+</ul>
+{{- template "changelog" .Changelog}}
+{{- if .Diagram}}
+<h2>ER 图</h2>
+<pre class="{{.DiagramType}}">{{.Diagram}}</pre>
+{{- if eq .DiagramType "mermaid"}}
+<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>
+{{- end}}
+{{- end}}
+{{range .Tables}}
+<h2 id="{{.Name}}">表名 {{.Name}}</h2>
+{{- if .Desc}}
+<p>{{.Desc}}</p>
+{{- end}}
+<table>
+<tr><th>序号</th><th>名称</th><th>数据类型</th><th>允许空值</th><th>说明</th></tr>
+{{- range $i, $f := .Fields}}
+<tr><td>{{inc $i}}</td><td>{{$f.Name}}</td><td>{{$f.Type}}</td><td>{{$f.Nullable}}</td><td>{{$f.Desc}}{{if $f.RefTable}} (<a href="#{{$f.RefTable}}">{{$f.RefTable}}.{{$f.RefField}}</a>){{end}}</td></tr>
+{{- end}}
+</table>
+{{- if .Keys}}
+<h3>索引</h3>
+<table>
+<tr><th>序号</th><th>索引名</th><th>类型</th><th>字段名</th></tr>
+{{- range $i, $k := .Keys}}
+<tr><td>{{inc $i}}</td><td>{{$k.Name | default "-"}}</td><td>{{$k.Type}}</td><td>{{join $k.Fields ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .ForeignKeys}}
+<h3>外键</h3>
+<table>
+<tr><th>序号</th><th>外键名</th><th>字段名</th><th>引用表</th><th>引用字段</th><th>ON DELETE</th><th>ON UPDATE</th></tr>
+{{- range $i, $k := .ForeignKeys}}
+<tr><td>{{inc $i}}</td><td>{{$k.Name | default "-"}}</td><td>{{join $k.Fields ", "}}</td><td><a href="#{{$k.RefTable}}">{{$k.RefTable}}</a></td><td>{{join $k.RefFields ", "}}</td><td>{{$k.OnDelete | default "-"}}</td><td>{{$k.OnUpdate | default "-"}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .ReferencedBy}}
+<h3>被引用</h3>
+<table>
+<tr><th>序号</th><th>表名</th><th>字段名</th><th>引用字段</th></tr>
+{{- range $i, $k := .ReferencedBy}}
+<tr><td>{{inc $i}}</td><td><a href="#{{$k.Table}}">{{$k.Table}}</a></td><td>{{join $k.Fields ", "}}</td><td>{{join $k.RefFields ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- template "tableExtra" .}}
+{{end}}
+</body>
+</html>
+`
+
+// htmlBlocksTpl holds the blocks shared by the html document and site pages
+const htmlBlocksTpl = `
+{{- define "changelog"}}
+{{- with .}}
+<h2>变更记录</h2>
+<p>自 {{.Since}} 以来</p>
+{{- if .Changes}}
+<table>
+<tr><th>序号</th><th>表名</th><th>变更</th><th>名称</th><th>变更前</th><th>变更后</th></tr>
+{{- range $i, $c := .Changes}}
+<tr><td>{{inc $i}}</td><td>{{$c.Table}}</td><td>{{change $c.Type}}</td><td>{{$c.Name | default "-"}}</td><td>{{$c.From | default "-"}}</td><td>{{$c.To | default "-"}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>无变更</p>
+{{- end}}
+{{- end}}
+{{- end}}
+{{- define "tableExtra"}}
+{{- with .Stats}}
+<h3>统计</h3>
+<table>
+<tr><th>行数(估算)</th><th>数据大小</th><th>索引大小</th><th>自增值</th><th>更新时间</th></tr>
+<tr><td>{{.Rows}}</td><td>{{size .DataLength}}</td><td>{{size .IndexLength}}</td><td>{{.AutoIncrement}}</td><td>{{.UpdateTime | default "-"}}</td></tr>
+</table>
+{{- end}}
+{{- with .Samples}}
+<h3>样例数据</h3>
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+`
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// server serves the documentation of the live schema, the schema is
+// reloaded on request once it is older than the refresh interval
+type server struct {
+	*Doc
+	refresh time.Duration
+
+	sync.Mutex
+	doc     *schemaDoc
+	updated time.Time
+}
+
+func newServer(doc *Doc, refresh time.Duration) *server {
+	return &server{Doc: doc, refresh: refresh}
+}
+
+// schema returns the cached schema document, reloading it if expired
+func (p *server) schema() (*schemaDoc, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.doc != nil && time.Since(p.updated) < p.refresh {
+		return p.doc, nil
+	}
+
+	dict, err := loadDict(p.dict, p.lang)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := p.schemaDoc(dict)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.errs) > 0 {
+		writeTableErrors(os.Stderr, p.errs)
+	}
+
+	p.doc, p.updated = doc, time.Now()
+	return doc, nil
+}
+
+func (p *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", p.handleIndex)
+	mux.HandleFunc("/tables/", p.handleTable)
+	mux.HandleFunc("/search-index.js", p.handleSearchIndex)
+	mux.HandleFunc("/search.js", staticHandler("application/javascript", siteSearchJs))
+	mux.HandleFunc("/style.css", staticHandler("text/css", siteStyleCss))
+	mux.HandleFunc("/api/schema", p.handleApiSchema)
+	mux.HandleFunc("/api/tables", p.handleApiTables)
+	mux.HandleFunc("/api/tables/", p.handleApiTable)
+	return mux
+}
+
+func (p *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/index.html" {
+		http.NotFound(w, r)
+		return
+	}
+
+	doc, err := p.schema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := &sitePage{Doc: doc, Title: doc.Name, Groups: siteGroups(doc)}
+	p.writePage(w, "index", page)
+}
+
+// handleTable serves /tables/<name>.html
+func (p *server) handleTable(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tables/"), ".html")
+
+	doc, err := p.schema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t := doc.table(name)
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := &sitePage{Doc: doc, Root: "../", Title: t.Name, Table: t}
+	p.writePage(w, "table", page)
+}
+
+func (p *server) handleSearchIndex(w http.ResponseWriter, r *http.Request) {
+	doc, err := p.schema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(searchIndex(doc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	fmt.Fprintf(w, "var searchIndex = %s;\n", b)
+}
+
+func (p *server) handleApiSchema(w http.ResponseWriter, r *http.Request) {
+	doc, err := p.schema()
+	if err != nil {
+		writeJsonError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, doc)
+}
+
+// tableSummary is an item of /api/tables
+type tableSummary struct {
+	Name   string `json:"name"`
+	Desc   string `json:"desc,omitempty"`
+	Fields int    `json:"fields"`
+}
+
+func (p *server) handleApiTables(w http.ResponseWriter, r *http.Request) {
+	doc, err := p.schema()
+	if err != nil {
+		writeJsonError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	tables := make([]tableSummary, 0, len(doc.Tables))
+	for _, t := range doc.Tables {
+		tables = append(tables, tableSummary{Name: t.Name, Desc: t.Desc, Fields: len(t.Fields)})
+	}
+	writeJson(w, tables)
+}
+
+// handleApiTable serves /api/tables/<name>
+func (p *server) handleApiTable(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/tables/")
+
+	doc, err := p.schema()
+	if err != nil {
+		writeJsonError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	t := doc.table(name)
+	if t == nil {
+		writeJsonError(w, fmt.Errorf("table %q not found", name), http.StatusNotFound)
+		return
+	}
+	writeJson(w, t)
+}
+
+func (p *server) writePage(w http.ResponseWriter, name string, page *sitePage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := siteTpl.ExecuteTemplate(w, name, page); err != nil {
+		fmt.Fprintf(os.Stderr, "render %s err %s\n", name, err)
+	}
+}
+
+func staticHandler(contentType, content string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		w.Write([]byte(content))
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeJsonError(w http.ResponseWriter, err error, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
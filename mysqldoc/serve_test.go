@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s := newServer(&Doc{Config: &Config{file: "./testdata/schema.sql"}}, time.Minute)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	cases := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/", 200, `<a href="tables/order.html">order</a>`},
+		{"/tables/order.html", 200, `<a href="user.html#c-id">user.id</a>`},
+		{"/tables/nonexistent.html", 404, ""},
+		{"/search-index.js", 200, "var searchIndex = "},
+		{"/api/tables", 200, `"name": "user_log"`},
+		{"/api/tables/user", 200, `"comment": "login name"`},
+		{"/api/tables/nonexistent", 404, `"error"`},
+		{"/api/schema", 200, `"referencedBy"`},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(ts.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.code {
+			t.Errorf("%s: code got %d want %d", c.path, resp.StatusCode, c.code)
+		}
+		if !strings.Contains(string(b), c.want) {
+			t.Errorf("%s: want %q in\n%s", c.path, c.want, b)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/api/tables/order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	table := &tableDoc{}
+	if err := json.NewDecoder(resp.Body).Decode(table); err != nil {
+		t.Fatal(err)
+	}
+	if len(table.ForeignKeys) != 1 || table.ForeignKeys[0].RefTable != "user" {
+		t.Errorf("unexpected table %+v", table)
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	s := newServer(&Doc{Config: &Config{file: "./testdata/schema.sql"}}, time.Hour)
+	d1, err := s.schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2, _ := s.schema(); d1 != d2 {
+		t.Errorf("expected the cached schema")
+	}
+
+	s.refresh = 0
+	if d3, _ := s.schema(); d1 == d3 {
+		t.Errorf("expected the schema to be reloaded")
+	}
+}
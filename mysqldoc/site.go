@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// siteGroup is a set of tables sharing the same name prefix
+type siteGroup struct {
+	Prefix string
+	Tables []*tableDoc
+}
+
+type sitePage struct {
+	Doc    *schemaDoc
+	Root   string // relative path to the site root, e.g. "../"
+	Title  string
+	Groups []siteGroup
+	Table  *tableDoc
+}
+
+// searchEntry is an item of the client-side search index
+type searchEntry struct {
+	Table  string `json:"t"`
+	Column string `json:"c,omitempty"`
+	Desc   string `json:"d,omitempty"`
+	Url    string `json:"u"`
+}
+
+var siteTpl = htmltemplate.Must(htmltemplate.Must(htmltemplate.New("site").
+	Funcs(htmltemplate.FuncMap(tplFuncs)).Parse(siteLayoutTpl)).Parse(htmlBlocksTpl))
+
+// writeSite renders doc as a static site into dir:
+//
+//	index.html          tables grouped by name prefix
+//	tables/<name>.html  one page per table
+//	search-index.js     client-side search index
+//	search.js, style.css
+func writeSite(doc *schemaDoc, dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, "tables"), 0755); err != nil {
+		return err
+	}
+
+	index := &sitePage{Doc: doc, Title: doc.Name, Groups: siteGroups(doc)}
+	if err := writeSitePage(filepath.Join(dir, "index.html"), "index", index); err != nil {
+		return err
+	}
+
+	for _, t := range doc.Tables {
+		page := &sitePage{Doc: doc, Root: "../", Title: t.Name, Table: t}
+		if err := writeSitePage(filepath.Join(dir, "tables", t.Name+".html"), "table", page); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(searchIndex(doc))
+	if err != nil {
+		return err
+	}
+	files := map[string]string{
+		"search-index.js": "var searchIndex = " + string(b) + ";\n",
+		"search.js":       siteSearchJs,
+		"style.css":       siteStyleCss,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeSitePage(file, name string, page *sitePage) error {
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	if err := siteTpl.ExecuteTemplate(fd, name, page); err != nil {
+		return err
+	}
+	return fd.Close()
+}
+
+// tablePrefix returns the part of the name before the first "_"
+func tablePrefix(name string) string {
+	return strings.SplitN(name, "_", 2)[0]
+}
+
+func siteGroups(doc *schemaDoc) []siteGroup {
+	groups := map[string]*siteGroup{}
+	for _, t := range doc.Tables {
+		prefix := tablePrefix(t.Name)
+		g, ok := groups[prefix]
+		if !ok {
+			g = &siteGroup{Prefix: prefix}
+			groups[prefix] = g
+		}
+		g.Tables = append(g.Tables, t)
+	}
+
+	ret := make([]siteGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Slice(g.Tables, func(i, j int) bool { return g.Tables[i].Name < g.Tables[j].Name })
+		ret = append(ret, *g)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Prefix < ret[j].Prefix })
+
+	return ret
+}
+
+func searchIndex(doc *schemaDoc) []searchEntry {
+	var entries []searchEntry
+	for _, t := range doc.Tables {
+		url := "tables/" + t.Name + ".html"
+		entries = append(entries, searchEntry{Table: t.Name, Desc: t.Desc, Url: url})
+		for _, f := range t.Fields {
+			entries = append(entries, searchEntry{
+				Table:  t.Name,
+				Column: f.Name,
+				Desc:   f.Desc,
+				Url:    url + "#c-" + f.Name,
+			})
+		}
+	}
+	return entries
+}
+
+const siteLayoutTpl = `
+{{- define "header" -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body data-root="{{.Root}}">
+<nav>
+<a href="{{.Root}}index.html">{{.Doc.Name}}</a>
+<input id="search" type="search" placeholder="search tables and columns" autocomplete="off">
+<ul id="search-results"></ul>
+</nav>
+<main>
+{{- end}}
+
+{{- define "footer"}}
+</main>
+<script src="{{.Root}}search-index.js"></script>
+<script src="{{.Root}}search.js"></script>
+</body>
+</html>
+{{end}}
+
+{{- define "index"}}
+{{- template "header" .}}
+<h1>{{.Doc.Name}}</h1>
+<p>{{len .Doc.Tables}} tables</p>
+{{- template "changelog" .Doc.Changelog}}
+{{- range .Groups}}
+<h2 id="g-{{.Prefix}}">{{.Prefix}}</h2>
+<table>
+<tr><th>表名</th><th>字段数</th><th>说明</th></tr>
+{{- range .Tables}}
+<tr><td><a href="tables/{{.Name}}.html">{{.Name}}</a></td><td>{{len .Fields}}</td><td>{{.Desc}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- template "footer" .}}
+{{- end}}
+
+{{- define "table"}}
+{{- template "header" .}}
+{{- with .Table}}
+<h1>表名 {{.Name}}</h1>
+{{- if .Desc}}
+<p>{{.Desc}}</p>
+{{- end}}
+<table>
+<tr><th>序号</th><th>名称</th><th>数据类型</th><th>允许空值</th><th>缺省值</th><th>键</th><th>说明</th></tr>
+{{- range $i, $f := .Fields}}
+<tr id="c-{{$f.Name}}"><td>{{inc $i}}</td><td>{{$f.Name}}</td><td>{{$f.Type}}</td><td>{{$f.Nullable}}</td><td>{{$f.Default}}</td><td>{{$f.Key}}</td><td>{{$f.Desc}}{{if $f.RefTable}} &rarr; <a href="{{$f.RefTable}}.html#c-{{$f.RefField}}">{{$f.RefTable}}.{{$f.RefField}}</a>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if .Keys}}
+<h2>索引</h2>
+<table>
+<tr><th>序号</th><th>索引名</th><th>类型</th><th>字段名</th></tr>
+{{- range $i, $k := .Keys}}
+<tr><td>{{inc $i}}</td><td>{{$k.Name | default "-"}}</td><td>{{$k.Type}}</td><td>{{join $k.Fields ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .ForeignKeys}}
+<h2>外键</h2>
+<table>
+<tr><th>序号</th><th>外键名</th><th>字段名</th><th>引用表</th><th>引用字段</th><th>ON DELETE</th><th>ON UPDATE</th></tr>
+{{- range $i, $k := .ForeignKeys}}
+<tr><td>{{inc $i}}</td><td>{{$k.Name | default "-"}}</td><td>{{join $k.Fields ", "}}</td><td><a href="{{$k.RefTable}}.html">{{$k.RefTable}}</a></td><td>{{join $k.RefFields ", "}}</td><td>{{$k.OnDelete | default "-"}}</td><td>{{$k.OnUpdate | default "-"}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .ReferencedBy}}
+<h2>被引用</h2>
+<table>
+<tr><th>序号</th><th>表名</th><th>字段名</th><th>引用字段</th></tr>
+{{- range $i, $k := .ReferencedBy}}
+<tr><td>{{inc $i}}</td><td><a href="{{$k.Table}}.html">{{$k.Table}}</a></td><td>{{join $k.Fields ", "}}</td><td>{{join $k.RefFields ", "}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- template "tableExtra" .}}
+{{- end}}
+{{- template "footer" .}}
+{{- end}}
+`
+
+const siteSearchJs = `(function () {
+  var input = document.getElementById("search");
+  var list = document.getElementById("search-results");
+  var root = document.body.getAttribute("data-root") || "";
+
+  input.addEventListener("input", function () {
+    var q = input.value.trim().toLowerCase();
+    list.innerHTML = "";
+    if (!q) {
+      return;
+    }
+
+    var n = 0;
+    for (var i = 0; i < searchIndex.length && n < 50; i++) {
+      var e = searchIndex[i];
+      var text = (e.t + "." + (e.c || "") + " " + (e.d || "")).toLowerCase();
+      if (text.indexOf(q) < 0) {
+        continue;
+      }
+
+      var li = document.createElement("li");
+      var a = document.createElement("a");
+      a.href = root + e.u;
+      a.textContent = e.c ? e.t + "." + e.c : e.t;
+      li.appendChild(a);
+      if (e.d) {
+        li.appendChild(document.createTextNode(" " + e.d));
+      }
+      list.appendChild(li);
+      n++;
+    }
+  });
+})();
+`
+
+const siteStyleCss = `body { font-family: sans-serif; margin: 0; }
+nav { position: sticky; top: 0; background: #f3f3f3; padding: 8px 2em; border-bottom: 1px solid #ccc; }
+nav > a { font-weight: bold; margin-right: 1em; }
+#search { width: 24em; padding: 4px; }
+#search-results { position: absolute; background: #fff; border: 1px solid #ccc; margin: 0; padding: 4px 1em; list-style: none; max-height: 60vh; overflow: auto; }
+#search-results:empty { display: none; }
+main { margin: 1em 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f3f3f3; }
+tr:target { background: #fff3c4; }
+`
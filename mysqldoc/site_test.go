@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSite(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	groups := siteGroups(doc)
+	if len(groups) != 2 || groups[0].Prefix != "order" || groups[1].Prefix != "user" || len(groups[1].Tables) != 2 {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+
+	dir := t.TempDir()
+	if err := writeSite(doc, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"index.html":           `<a href="tables/user_log.html">user_log</a>`,
+		"tables/order.html":    `<a href="user.html#c-id">user.id</a>`,
+		"tables/user.html":     `<a href="order.html">order</a>`,
+		"search-index.js":      `"t":"user","c":"name","d":"login name","u":"tables/user.html#c-name"`,
+		"search.js":            "searchIndex",
+		"style.css":            "#search",
+		"tables/user_log.html": `<tr id="c-action">`,
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("%s: want %q in\n%s", file, want, b)
+		}
+	}
+}
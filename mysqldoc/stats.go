@@ -0,0 +1,139 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yubo/gotool/mysqlschema"
+)
+
+const (
+	sampleMaskValue = "***"
+	sampleMaxLen    = 64
+)
+
+type tableStats struct {
+	Rows          int64  `json:"rows"` // approximate for InnoDB
+	DataLength    int64  `json:"dataLength"`
+	IndexLength   int64  `json:"indexLength"`
+	AutoIncrement int64  `json:"autoIncrement,omitempty"`
+	UpdateTime    string `json:"updateTime,omitempty"`
+}
+
+type sampleDoc struct {
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// loadStats fills the table statistics from information_schema.TABLES
+func (p *Doc) loadStats(doc *schemaDoc) error {
+	rows, err := p.db.RawDB().Query("SELECT TABLE_NAME, IFNULL(TABLE_ROWS, 0), IFNULL(DATA_LENGTH, 0), " +
+		"IFNULL(INDEX_LENGTH, 0), IFNULL(AUTO_INCREMENT, 0), IFNULL(CAST(UPDATE_TIME AS CHAR), '') " +
+		"FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		s := &tableStats{}
+		if err := rows.Scan(&name, &s.Rows, &s.DataLength, &s.IndexLength, &s.AutoIncrement, &s.UpdateTime); err != nil {
+			return err
+		}
+		if t := doc.table(name); t != nil {
+			t.Stats = s
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadSamples fills at most n rows of each table, the columns
+// matched by the mask patterns are replaced by sampleMaskValue.
+// The tables failed to be sampled are recorded in p.errs
+func (p *Doc) loadSamples(doc *schemaDoc, n int, masks []string) {
+	for _, t := range doc.Tables {
+		s, err := p.sampleTable(t.Name, n, masks)
+		if err != nil {
+			p.errs = append(p.errs, &mysqlschema.TableError{Table: t.Name, Err: fmt.Errorf("sample: %s", err)})
+			continue
+		}
+		t.Samples = s
+	}
+}
+
+func (p *Doc) sampleTable(table string, n int, masks []string) (*sampleDoc, error) {
+	rows, err := p.db.RawDB().Query(fmt.Sprintf("SELECT * FROM `%s` LIMIT %d", strings.ReplaceAll(table, "`", "``"), n))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	masked := make([]bool, len(cols))
+	for i, col := range cols {
+		masked[i] = matchColumn(masks, table, col)
+	}
+
+	s := &sampleDoc{Columns: cols}
+	values := make([]sql.RawBytes, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(cols))
+		for i, v := range values {
+			switch {
+			case masked[i]:
+				row[i] = sampleMaskValue
+			case v == nil:
+				row[i] = "NULL"
+			default:
+				row[i] = sampleValue(v)
+			}
+		}
+		s.Rows = append(s.Rows, row)
+	}
+
+	return s, rows.Err()
+}
+
+// sampleValue makes v printable in a single table cell
+func sampleValue(v []byte) string {
+	if !utf8.Valid(v) {
+		return fmt.Sprintf("(binary %d bytes)", len(v))
+	}
+
+	s := strings.Join(strings.Fields(string(v)), " ")
+	if utf8.RuneCountInString(s) > sampleMaxLen {
+		s = string([]rune(s)[:sampleMaxLen]) + "..."
+	}
+	return s
+}
+
+// humanSize formats bytes, e.g. 1536 -> "1.5 KiB"
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
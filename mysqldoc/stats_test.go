@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMatchColumn(t *testing.T) {
+	masks := []string{"*.email", "users.phone", "password"}
+	cases := []struct {
+		table  string
+		column string
+		want   bool
+	}{
+		{"users", "email", true},
+		{"orders", "email", true},
+		{"users", "phone", true},
+		{"orders", "phone", false},
+		{"admin", "password", true},
+		{"users", "name", false},
+	}
+	for _, c := range cases {
+		if got := matchColumn(masks, c.table, c.column); got != c.want {
+			t.Errorf("%s.%s got %v want %v", c.table, c.column, got, c.want)
+		}
+	}
+}
+
+func TestSampleValue(t *testing.T) {
+	cases := []struct {
+		in   []byte
+		want string
+	}{
+		{[]byte("a\nb  c"), "a b c"},
+		{[]byte{0xff, 0xfe}, "(binary 2 bytes)"},
+		{[]byte(strings.Repeat("x", 70)), strings.Repeat("x", 64) + "..."},
+	}
+	for _, c := range cases {
+		if got := sampleValue(c.in); got != c.want {
+			t.Errorf("%q got %q want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:     "512 B",
+		1536:    "1.5 KiB",
+		1 << 20: "1.0 MiB",
+	} {
+		if got := humanSize(n); got != want {
+			t.Errorf("%d got %s want %s", n, got, want)
+		}
+	}
+}
+
+func TestRenderStats(t *testing.T) {
+	doc := testSchemaDoc(t)
+
+	user := doc.table("user")
+	user.Stats = &tableStats{Rows: 1000, DataLength: 1536, IndexLength: 512, AutoIncrement: 1005}
+	user.Samples = &sampleDoc{
+		Columns: []string{"id", "name", "email"},
+		Rows:    [][]string{{"1", "a|b", sampleMaskValue}},
+	}
+
+	for format, want := range map[string]string{
+		"markdown": "1000 | 1.5 KiB | 512 B | 1005 | -\n",
+		"asciidoc": "|1 |a\\|b |*** \n",
+		"html":     "<tr><td>1</td><td>a|b</td><td>***</td></tr>",
+	} {
+		r, _ := newRenderer(format)
+		buf := &bytes.Buffer{}
+		if err := r.Render(buf, doc); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s: want %q in\n%s", format, want, buf.String())
+		}
+	}
+
+	p := &Doc{Config: &Config{file: "./testdata/schema.sql", stats: true}}
+	if _, err := p.schemaDoc(nil); err == nil {
+		t.Errorf("expected error for --stats without --dsn")
+	}
+}
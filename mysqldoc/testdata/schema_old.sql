@@ -0,0 +1,24 @@
+CREATE TABLE `user` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'user id',
+  `name` varchar(128) NOT NULL DEFAULT '' COMMENT 'login name',
+  `email` varchar(128) NOT NULL DEFAULT '',
+  `status` enum('active','disabled') NOT NULL DEFAULT 'active' COMMENT 'account status',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB AUTO_INCREMENT=1005 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='users';
+
+CREATE TABLE `order` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned NOT NULL COMMENT 'owner',
+  `amount` decimal(10,2) NOT NULL DEFAULT '0.00',
+  `note` text,
+  `remark` varchar(64) DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  KEY `fk_order_user` (`user_id`,`amount`),
+  CONSTRAINT `fk_order_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `legacy` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
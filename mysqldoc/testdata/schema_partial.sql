@@ -0,0 +1,11 @@
+CREATE TABLE `user` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'user id',
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='users';
+
+CREATE TABLE `metric` (
+  `id` bigint unsigned NOT NULL,
+  `ts` datetime NOT NULL,
+  PRIMARY KEY (`id`,`ts`)
+)
+PARTITION BY RANGE COLUMNS(ts) (PARTITION p0 VALUES LESS THAN ('2020-01-01'));
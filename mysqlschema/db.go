@@ -0,0 +1,56 @@
+package mysqlschema
+
+import (
+	"github.com/yubo/golib/orm"
+)
+
+// CreateTableSql returns the output of `show create table`
+func CreateTableSql(db orm.DB, table string) (sql string, err error) {
+	var name string
+	err = db.Query("show create table "+table).Row(&name, &sql)
+	return
+}
+
+// ParseTables parses all the tables of the connected database, like
+// ParseSql the failed tables are returned as ParseErrors
+func ParseTables(db orm.DB) ([]*MysqlTable, error) {
+	var tabNames []string
+
+	if err := db.Query("show tables").Rows(&tabNames); err != nil {
+		return nil, err
+	}
+
+	var errs ParseErrors
+	tables := make([]*MysqlTable, 0, len(tabNames))
+	// show create table xxx;
+	for _, v := range tabNames {
+		sql, err := CreateTableSql(db, v)
+		if err != nil {
+			errs = append(errs, &TableError{Table: v, Err: err})
+			continue
+		}
+		t, err := ParseTableSql(sql + ";")
+		if err != nil {
+			e := err.(*TableError)
+			e.Table = v
+			errs = append(errs, e)
+			continue
+		}
+		tables = append(tables, t)
+	}
+	parseTableEx(tables)
+
+	if len(errs) > 0 {
+		return tables, errs
+	}
+	return tables, nil
+}
+
+// ParseTable parses a single table of the connected database
+func ParseTable(db orm.DB, tabName string) (*MysqlTable, error) {
+	sql, err := CreateTableSql(db, tabName)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTableSql(sql + ";")
+}
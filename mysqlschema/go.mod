@@ -0,0 +1,5 @@
+module github.com/yubo/gotool/mysqlschema
+
+go 1.16
+
+require github.com/yubo/golib v0.0.1
@@ -1,112 +1,82 @@
-package main
+package mysqlschema
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"regexp"
 	"sort"
 	"strings"
-
-	"github.com/yubo/golib/orm"
 )
 
-type FieldInfo struct {
-	Name string // 字段名
-	Desc string // 字段描述
-}
-
-type KeyInfo struct {
-	Name   string // 键名
-	Type   string // 键类型
-	Fields string // 键的字段列表
-}
-
-type EngineInfo struct {
-	Name string // 引擎名
-	Desc string // 引擎描述
-}
-
-type MysqlTable struct {
-	Name       string      // 表名
-	SqlStr     string      // sql语句
-	Fields     []FieldInfo // 字段列表
-	Keys       []KeyInfo   // 键列表
-	Engine     EngineInfo  // 引擎
-	IsChild    bool        // 是否是子表
-	ChildNames []string    // 子表名列表
-	LikeTbl    string      // like的表名
-}
-
 var (
 	// regexps
-	lineRe  = regexp.MustCompile(`.*?\n`)
-	likeRe  = regexp.MustCompile(`like\s+?` + "`" + `(\S+)` + "`")
-	tnmRe   = regexp.MustCompile(`CREATE\s+TABLE\s+` + "`" + `(\S+?)` + "`" + "(.+)")
-	fldRe   = regexp.MustCompile(`^\s*` + "`" + `(\S+)` + "`" + `\s*(.+),`)
-	keyRe   = regexp.MustCompile(`^\s*(.*?KEY)\s*(\S*)\s*\((.+?)\)`)
-	knmRe   = regexp.MustCompile("`" + `(\S+)` + "`")
-	ngnRe   = regexp.MustCompile(`^\s*\)\s*?ENGINE=(\S+)\s*(.*);`)
-	childRe = regexp.MustCompile(`UNION=\((\S+)\)`)
-	tnameRe = regexp.MustCompile("`" + `(\S+)` + "`")
+	createRe = regexp.MustCompile(`(?s)CREATE\s+?TABLE.+?;`)
+	lineRe   = regexp.MustCompile(`.*?\n`)
+	likeRe   = regexp.MustCompile(`like\s+?` + "`" + `(\S+)` + "`")
+	tnmRe    = regexp.MustCompile(`CREATE\s+TABLE\s+(?:IF NOT EXISTS\s+)?` + "`" + `(\S+?)` + "`" + "(.+)")
+	fldRe    = regexp.MustCompile(`^\s*` + "`" + `(\S+)` + "`" + `\s*(.+),`)
+	keyRe    = regexp.MustCompile(`^\s*(.*?KEY)\s*(\S*)\s*\((.+?)\)`)
+	knmRe    = regexp.MustCompile("`" + `(\S+)` + "`")
+	fkRe     = regexp.MustCompile(`^\s*(?:CONSTRAINT\s+` + "`" + `(\S+)` + "`" + `\s+)?FOREIGN KEY\s*\((.+?)\)\s*REFERENCES\s+(\S+?)\s*\((.+?)\)(.*)`)
+	fkOnRe   = regexp.MustCompile(`ON (DELETE|UPDATE) (RESTRICT|CASCADE|SET NULL|NO ACTION|SET DEFAULT)`)
+	ngnRe    = regexp.MustCompile(`^\s*\)\s*?ENGINE=(\S+)\s*(.*);`)
+	childRe  = regexp.MustCompile(`UNION=\((\S+)\)`)
+	tnameRe  = regexp.MustCompile("`" + `(\S+)` + "`")
 )
 
-func parseTablesFromFile(file string) ([]*MysqlTable, error) {
-	bytes, err := ioutil.ReadFile(file)
+// ParseFile parses the CREATE TABLE statements of a sql file,
+// e.g. the output of `mysqldump --no-data`, "-" reads from stdin
+func ParseFile(file string) ([]*MysqlTable, error) {
+	var bytes []byte
+	var err error
+	if file == "-" {
+		bytes, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		bytes, err = ioutil.ReadFile(file)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	re := regexp.MustCompile(`(?s)CREATE\s+?TABLE.+?;`)
-	tableNames := re.FindAllString(string(bytes), -1)
+	tables, err := ParseSql(string(bytes))
+	if _, ok := err.(ParseErrors); err != nil && !ok {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return tables, err
+}
+
+// ParseSql parses all the CREATE TABLE statements of sql, the tables
+// which could not be parsed are skipped and returned as ParseErrors
+// along with the other tables
+func ParseSql(sql string) ([]*MysqlTable, error) {
+	tableNames := createRe.FindAllString(sql, -1)
 	if len(tableNames) == 0 {
-		return nil, err
+		return nil, errors.New("no CREATE TABLE statement found")
 	}
 
+	var errs ParseErrors
 	tables := make([]*MysqlTable, 0, len(tableNames))
 	for _, tbstr := range tableNames {
-		t, err := parseTableSql(tbstr)
+		t, err := ParseTableSql(tbstr)
 		if err != nil {
-			return nil, err
+			errs = append(errs, err.(*TableError))
+			continue
 		}
 		tables = append(tables, t)
 	}
 	parseTableEx(tables)
-	return tables, nil
-}
-
-func parseTables(db orm.DB) ([]*MysqlTable, error) {
-	var tabNames []string
-
-	if err := db.Query("show tables").Rows(&tabNames); err != nil {
-		return nil, err
-	}
 
-	tables := make([]*MysqlTable, 0, len(tabNames))
-	// show create table xxx;
-	for _, v := range tabNames {
-		sql, err := getTableCreateSql(db, v)
-		if err != nil {
-			return nil, err
-		}
-		t, err := parseTableSql(sql + ";")
-		if err != nil {
-			return nil, err
-		}
-		tables = append(tables, t)
+	if len(errs) > 0 {
+		return tables, errs
 	}
-	parseTableEx(tables)
 	return tables, nil
 }
 
-func parseTable(db orm.DB, tabName string) (*MysqlTable, error) {
-	sql, err := getTableCreateSql(db, tabName)
-	if err != nil {
-		return nil, err
-	}
-	return parseTableSql(sql + ";")
-}
-
-func parseTableSql(tabSql string) (*MysqlTable, error) {
+// ParseTableSql parses a single CREATE TABLE statement terminated by ";",
+// the error is a *TableError
+func ParseTableSql(tabSql string) (*MysqlTable, error) {
 	tabSql += "\n"
 
 	lines := lineRe.FindAllString(tabSql, -1)
@@ -125,7 +95,7 @@ func parseTableSql(tabSql string) (*MysqlTable, error) {
 			tblEx := ""
 			ret := tnmRe.FindStringSubmatch(line)
 			if len(ret) < 2 {
-				panic("解析表名错误, line:" + line)
+				return nil, &TableError{Sql: tabSql, Err: errors.New("解析表名错误, line:" + line)}
 			} else if len(ret) > 2 {
 				tblEx = ret[2]
 			}
@@ -156,6 +126,30 @@ func parseTableSql(tabSql string) (*MysqlTable, error) {
 
 			// 解析键（包括主键和其他键）
 			if step == "tflds_end" {
+				// 外键: CONSTRAINT `fk` FOREIGN KEY (`xx`) REFERENCES `yy` (`id`) ON DELETE CASCADE
+				if ret := fkRe.FindStringSubmatch(line); len(ret) == 6 {
+					fk := ForeignKeyInfo{
+						Name:      ret[1],
+						Fields:    strings.ReplaceAll(ret[2], " ", ""),
+						RefTable:  ret[3],
+						RefFields: strings.ReplaceAll(ret[4], " ", ""),
+					}
+					// `db`.`table` -> table
+					if i := strings.LastIndex(fk.RefTable, "."); i >= 0 {
+						fk.RefTable = fk.RefTable[i+1:]
+					}
+					fk.RefTable = strings.Trim(fk.RefTable, "`")
+					for _, on := range fkOnRe.FindAllStringSubmatch(ret[5], -1) {
+						if on[1] == "DELETE" {
+							fk.OnDelete = on[2]
+						} else {
+							fk.OnUpdate = on[2]
+						}
+					}
+					t.ForeignKeys = append(t.ForeignKeys, fk)
+					continue
+				}
+
 				ret := keyRe.FindStringSubmatch(line) // RRIMARY KEY (`id`) 或 KEY `key_idx` (`xx`, `yy`)
 				if len(ret) == 4 {
 					var keyType, keyName, keyFlds string
@@ -217,11 +211,13 @@ func parseTableSql(tabSql string) (*MysqlTable, error) {
 
 	// append to table list
 	if step != "t_end" {
-		return nil, errors.New("解析table错误, sql:\n" + tabSql)
+		return nil, &TableError{Table: t.Name, Sql: tabSql, Err: errors.New("解析table错误")}
 	}
 	return &t, nil
 }
 
+// parseTableEx marks the child tables of the merge tables and copies
+// the definitions of the `create table xxx like yyy` tables
 func parseTableEx(tbls []*MysqlTable) {
 	childList := make([]string, 0)
 	likeMap := make(map[string]string)
@@ -255,6 +251,7 @@ func parseTableEx(tbls []*MysqlTable) {
 			t := tblMap[tnm]
 			t.Fields = append(t.Fields, lkt.Fields...)
 			t.Keys = append(t.Keys, lkt.Keys...)
+			t.ForeignKeys = append(t.ForeignKeys, lkt.ForeignKeys...)
 			t.Engine = lkt.Engine
 		}
 	}
@@ -0,0 +1,101 @@
+package mysqlschema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSql = "CREATE TABLE IF NOT EXISTS `user` (\n" +
+	"  `id` bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'user id',\n" +
+	"  `name` varchar(128) NOT NULL DEFAULT '',\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  UNIQUE KEY `index_name` (`name`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='users';\n" +
+	"CREATE TABLE `order` (\n" +
+	"  `id` bigint unsigned NOT NULL AUTO_INCREMENT,\n" +
+	"  `user_id` bigint unsigned NOT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `fk_order_user` (`user_id`),\n" +
+	"  CONSTRAINT `fk_order_user` FOREIGN KEY (`user_id`) REFERENCES `user` (`id`) ON DELETE CASCADE\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n" +
+	"CREATE TABLE `user_bak` like `user`;\n" +
+	"CREATE TABLE `log_1` (\n" +
+	"  `id` bigint NOT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=MyISAM;\n" +
+	"CREATE TABLE `log` (\n" +
+	"  `id` bigint NOT NULL,\n" +
+	"  PRIMARY KEY (`id`)\n" +
+	") ENGINE=MRG_MyISAM UNION=(`log_1`);\n"
+
+func TestParseSql(t *testing.T) {
+	tables, err := ParseSql(testSql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 5 {
+		t.Fatalf("got %d tables want 5", len(tables))
+	}
+
+	user := tables[0]
+	if user.Name != "user" || user.Engine.Name != "InnoDB" {
+		t.Errorf("unexpected table %s engine %s", user.Name, user.Engine.Name)
+	}
+	wantFields := []FieldInfo{
+		{"id", "bigint unsigned NOT NULL AUTO_INCREMENT COMMENT 'user id'"},
+		{"name", "varchar(128) NOT NULL DEFAULT ''"},
+	}
+	if !reflect.DeepEqual(user.Fields, wantFields) {
+		t.Errorf("fields got %v want %v", user.Fields, wantFields)
+	}
+	wantKeys := []KeyInfo{
+		{"", "PRIMARY KEY", "`id`"},
+		{"index_name", "UNIQUE KEY", "`name`"},
+	}
+	if !reflect.DeepEqual(user.Keys, wantKeys) {
+		t.Errorf("keys got %v want %v", user.Keys, wantKeys)
+	}
+
+	wantFk := []ForeignKeyInfo{{"fk_order_user", "`user_id`", "user", "`id`", "CASCADE", ""}}
+	if fks := tables[1].ForeignKeys; !reflect.DeepEqual(fks, wantFk) {
+		t.Errorf("foreign keys got %v want %v", fks, wantFk)
+	}
+
+	if bak := tables[2]; bak.LikeTbl != "user" || !reflect.DeepEqual(bak.Fields, wantFields) {
+		t.Errorf("like table got %s %v", bak.LikeTbl, bak.Fields)
+	}
+
+	if !tables[3].IsChild || tables[4].IsChild || !reflect.DeepEqual(tables[4].ChildNames, []string{"log_1"}) {
+		t.Errorf("unexpected merge table %v %v", tables[3].IsChild, tables[4].ChildNames)
+	}
+}
+
+func TestParseSqlError(t *testing.T) {
+	if _, err := ParseSql("select 1;"); err == nil {
+		t.Errorf("expected error without CREATE TABLE")
+	}
+	if _, err := ParseTableSql("CREATE TABLE user (id int);"); err == nil {
+		t.Errorf("expected error for unquoted table name")
+	}
+}
+
+func TestParseSqlPartial(t *testing.T) {
+	bad := "CREATE TABLE `bad` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n) PARTITION BY HASH(id);"
+	tables, err := ParseSql(testSql + bad + "\nCREATE TABLE oops;")
+
+	if len(tables) != 5 {
+		t.Errorf("got %d tables want 5", len(tables))
+	}
+
+	errs, ok := err.(ParseErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if errs[0].Table != "bad" || errs[0].Sql == "" || errs[1].Table != "" {
+		t.Errorf("unexpected errors %v, %v", errs[0], errs[1])
+	}
+	if s := err.Error(); !strings.HasPrefix(s, "2 tables could not be parsed") {
+		t.Errorf("unexpected message %s", s)
+	}
+}
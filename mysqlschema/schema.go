@@ -0,0 +1,75 @@
+// Package mysqlschema parses MySQL table definitions, from a live
+// database (SHOW CREATE TABLE) or from sql files such as the output of
+// `mysqldump --no-data`, into a simple table model.
+package mysqlschema
+
+import (
+	"fmt"
+	"strings"
+)
+
+type FieldInfo struct {
+	Name string // 字段名
+	Desc string // 字段描述
+}
+
+type KeyInfo struct {
+	Name   string // 键名
+	Type   string // 键类型
+	Fields string // 键的字段列表
+}
+
+type ForeignKeyInfo struct {
+	Name      string // 约束名
+	Fields    string // 外键字段列表
+	RefTable  string // 引用的表名
+	RefFields string // 引用的字段列表
+	OnDelete  string // ON DELETE 动作
+	OnUpdate  string // ON UPDATE 动作
+}
+
+type EngineInfo struct {
+	Name string // 引擎名
+	Desc string // 引擎描述
+}
+
+// MysqlTable is a parsed CREATE TABLE statement
+type MysqlTable struct {
+	Name        string           // 表名
+	SqlStr      string           // sql语句
+	Fields      []FieldInfo      // 字段列表
+	Keys        []KeyInfo        // 键列表
+	ForeignKeys []ForeignKeyInfo // 外键列表
+	Engine      EngineInfo       // 引擎
+	IsChild     bool             // 是否是子表
+	ChildNames  []string         // 子表名列表
+	LikeTbl     string           // like的表名
+}
+
+// TableError is a table which could not be parsed or loaded
+type TableError struct {
+	Table string // empty if the table name could not be parsed
+	Sql   string // the offending CREATE TABLE statement, if any
+	Err   error
+}
+
+func (p *TableError) Error() string {
+	if p.Table == "" {
+		return fmt.Sprintf("table: %s", p.Err)
+	}
+	return fmt.Sprintf("table %s: %s", p.Table, p.Err)
+}
+
+func (p *TableError) Unwrap() error { return p.Err }
+
+// ParseErrors is returned along with the successfully parsed tables
+// when some of the tables could not be parsed
+type ParseErrors []*TableError
+
+func (p ParseErrors) Error() string {
+	names := make([]string, 0, len(p))
+	for _, v := range p {
+		names = append(names, v.Table)
+	}
+	return fmt.Sprintf("%d tables could not be parsed: %s", len(p), strings.Join(names, ", "))
+}
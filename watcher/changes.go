@@ -0,0 +1,149 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// changeSet is the debounced batch of changes passed to the commands,
+// as the placeholders of "go test {{.Dirs}}" or "gofmt -l {{.Files}}",
+// quoted for sh in a command line, and as environment variables:
+//
+//	WATCHER_PIPELINE      pipeline name
+//	WATCHER_FILES         changed files, separated by spaces
+//	WATCHER_DIRS          directories of the changed files
+//	WATCHER_CHANGES_FILE  file listing the changes, "op name" per line
+type changeSet struct {
+	Pipeline    string
+	Changes     []*change
+	Files       fileList // changed files
+	Dirs        fileList // directories of the changed files, e.g. ./pkg/foo
+	ChangesFile string
+}
+
+type change struct {
+	Name string
+	Op   fsnotify.Op
+}
+
+// fileList is printed separated by spaces in the placeholders
+type fileList []string
+
+func (p fileList) String() string {
+	return strings.Join(p, " ")
+}
+
+func newChangeSet(pipeline, changesFile string) *changeSet {
+	return &changeSet{Pipeline: pipeline, ChangesFile: changesFile}
+}
+
+// add merges the ops of the same file
+func (p *changeSet) add(e fsnotify.Event) {
+	name := filepath.Clean(e.Name)
+	for _, c := range p.Changes {
+		if c.Name == name {
+			c.Op |= e.Op
+			return
+		}
+	}
+	p.Changes = append(p.Changes, &change{Name: name, Op: e.Op})
+}
+
+// prepare fills Files and Dirs and writes the changes file
+func (p *changeSet) prepare() error {
+	files := map[string]bool{}
+	dirs := map[string]bool{}
+	var buf bytes.Buffer
+	for _, c := range p.Changes {
+		files[c.Name] = true
+		dir := filepath.Dir(c.Name)
+		if !filepath.IsAbs(dir) && dir != "." && !strings.HasPrefix(dir, "..") {
+			dir = "." + string(filepath.Separator) + dir
+		}
+		dirs[dir] = true
+		fmt.Fprintf(&buf, "%s %s\n", c.Op, c.Name)
+	}
+	p.Files = sortedKeys(files)
+	p.Dirs = sortedKeys(dirs)
+
+	if p.ChangesFile == "" {
+		return nil
+	}
+	return ioutil.WriteFile(p.ChangesFile, buf.Bytes(), 0644)
+}
+
+func (p *changeSet) env() []string {
+	return []string{
+		"WATCHER_PIPELINE=" + p.Pipeline,
+		"WATCHER_FILES=" + p.Files.String(),
+		"WATCHER_DIRS=" + p.Dirs.String(),
+		"WATCHER_CHANGES_FILE=" + p.ChangesFile,
+	}
+}
+
+// expand replaces the {{.Files}} and {{.Dirs}} placeholders of the
+// command, the names are quoted for sh if quote is set. Other braces are
+// kept, e.g. docker ps --format '{{.Names}}'
+func (p *changeSet) expand(cmd string, quote bool) string {
+	files, dirs := p.Files, p.Dirs
+	if quote {
+		files, dirs = quoteWords(files), quoteWords(dirs)
+	}
+	return strings.NewReplacer("{{.Files}}", files.String(), "{{.Dirs}}", dirs.String()).Replace(cmd)
+}
+
+// expandArgs expands each argument, the "{{.Files}}" and "{{.Dirs}}"
+// arguments are replaced by one argument per file
+func (p *changeSet) expandArgs(args []string) []string {
+	var ret []string
+	for _, v := range args {
+		switch strings.TrimSpace(v) {
+		case "{{.Files}}":
+			ret = append(ret, p.Files...)
+		case "{{.Dirs}}":
+			ret = append(ret, p.Dirs...)
+		default:
+			ret = append(ret, p.expand(v, false))
+		}
+	}
+	return ret
+}
+
+// quoteWords quotes the names for sh, so that a name like "a;`cmd`.go"
+// is one word of a command line
+func quoteWords(names fileList) fileList {
+	ret := make(fileList, len(names))
+	for i, v := range names {
+		ret[i] = quoteWord(v)
+	}
+	return ret
+}
+
+func (p *changeSet) String() string {
+	switch n := len(p.Changes); n {
+	case 0:
+		return "first time"
+	case 1:
+		return fmt.Sprintf("%s %s", p.Changes[0].Op, p.Changes[0].Name)
+	default:
+		return fmt.Sprintf("%s %s and %d more", p.Changes[0].Op, p.Changes[0].Name, n-1)
+	}
+}
+
+func sortedKeys(m map[string]bool) fileList {
+	ret := make(fileList, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
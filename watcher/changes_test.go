@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestChangeSet(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "changes")
+	cs := newChangeSet("api", file)
+	if s := cs.String(); s != "first time" {
+		t.Errorf("got %s", s)
+	}
+
+	for _, e := range []fsnotify.Event{
+		{Name: "pkg/a.go", Op: fsnotify.Create},
+		{Name: "./pkg/a.go", Op: fsnotify.Write},
+		{Name: "main.go", Op: fsnotify.Write},
+		{Name: "/abs/b.go", Op: fsnotify.Remove},
+		{Name: "../shared/c.go", Op: fsnotify.Write},
+	} {
+		cs.add(e)
+	}
+	if err := cs.prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (fileList{"../shared/c.go", "/abs/b.go", "main.go", "pkg/a.go"}); !reflect.DeepEqual(cs.Files, want) {
+		t.Errorf("files got %q want %q", cs.Files, want)
+	}
+	if want := (fileList{".", "../shared", "./pkg", "/abs"}); !reflect.DeepEqual(cs.Dirs, want) {
+		t.Errorf("dirs got %q want %q", cs.Dirs, want)
+	}
+	if s := cs.String(); s != "CREATE|WRITE pkg/a.go and 3 more" {
+		t.Errorf("got %s", s)
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CREATE|WRITE pkg/a.go\nWRITE main.go\nREMOVE /abs/b.go\nWRITE ../shared/c.go\n"
+	if string(b) != want {
+		t.Errorf("changes file got\n%s\nwant\n%s", b, want)
+	}
+
+	env := []string{
+		"WATCHER_PIPELINE=api",
+		"WATCHER_FILES=../shared/c.go /abs/b.go main.go pkg/a.go",
+		"WATCHER_DIRS=. ../shared ./pkg /abs",
+		"WATCHER_CHANGES_FILE=" + file,
+	}
+	if got := cs.env(); !reflect.DeepEqual(got, env) {
+		t.Errorf("env got %q want %q", got, env)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	cs := newChangeSet("api", "/tmp/changes")
+	cs.Files = fileList{"a b.go", "c.go"}
+	cs.Dirs = fileList{"."}
+
+	cases := []struct {
+		cmd   string
+		quote bool
+		want  string
+	}{
+		{"make", true, "make"},
+		{"go test {{.Dirs}}", true, "go test ."},
+		{"gofmt -l {{.Files}}", true, "gofmt -l 'a b.go' c.go"},
+		{"gofmt -l {{.Files}}", false, "gofmt -l a b.go c.go"},
+		{"docker ps --format '{{.Names}}'", true, "docker ps --format '{{.Names}}'"},
+		{"echo {{.Pipeline}} {{.Files", true, "echo {{.Pipeline}} {{.Files"},
+		{"{{range .Changes}}{{.Name}}{{end}}", true, "{{range .Changes}}{{.Name}}{{end}}"},
+	}
+	for _, c := range cases {
+		if got := cs.expand(c.cmd, c.quote); got != c.want {
+			t.Errorf("%s got %q want %q", c.cmd, got, c.want)
+		}
+	}
+
+	args := cs.expandArgs([]string{"gofmt", "-l", "{{.Files}}", " {{.Dirs}} ", "--files={{.Files}}", "{{.Names}}"})
+	if want := []string{"gofmt", "-l", "a b.go", "c.go", ".", "--files=a b.go c.go", "{{.Names}}"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args got %q want %q", args, want)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	envRe      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	safeWordRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+)
+
+// command is a command line, or an argument array, with its working
+// directory and extra environment variables. In yaml it's either a
+// string, an array or an object, e.g.
+//
+//	cmd: go build -o bin/api ./cmd/api
+//	cmd: ["go", "build", "-o", "bin/api", "./cmd/api"]
+//	cmd:
+//	  line: go generate ./... && go build ./...
+//	  shell: true
+//	  dir: api
+//	  env: ["CGO_ENABLED=0"]
+type command struct {
+	Line  string   `json:"line"`
+	Args  []string `json:"args"`
+	Shell bool     `json:"shell"` // run the line with /bin/sh -c
+	Dir   string   `json:"dir"`
+	Env   []string `json:"env"`
+}
+
+func (p *command) UnmarshalJSON(b []byte) error {
+	var line string
+	if err := json.Unmarshal(b, &line); err == nil {
+		*p = command{Line: line}
+		return nil
+	}
+
+	var args []string
+	if err := json.Unmarshal(b, &args); err == nil {
+		*p = command{Args: args}
+		return nil
+	}
+
+	type raw command
+	if err := json.Unmarshal(b, (*raw)(p)); err != nil {
+		return fmt.Errorf("command must be a string, an array or an object: %s", err)
+	}
+	if p.Line != "" && len(p.Args) > 0 {
+		return fmt.Errorf("command has both line and args")
+	}
+	return nil
+}
+
+func (p command) empty() bool {
+	return strings.TrimSpace(p.Line) == "" && len(p.Args) == 0
+}
+
+func (p command) String() string {
+	if len(p.Args) > 0 {
+		return strings.Join(p.Args, " ")
+	}
+	return p.Line
+}
+
+// build returns the cmd expanded by the change set. The line is run by
+// /bin/sh -c if Shell is set or it contains shell operators, otherwise
+// it's split into words and the leading "NAME=value" words are added
+// to the environment
+func (p command) build(cs *changeSet) (*exec.Cmd, error) {
+	if p.empty() {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	var args, env []string
+	if len(p.Args) > 0 {
+		args = cs.expandArgs(p.Args)
+	} else {
+		line := cs.expand(p.Line, true)
+		words, operator, err := splitWords(line)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q: %s", line, err)
+		}
+
+		if p.Shell || operator {
+			args = []string{"/bin/sh", "-c", line}
+		} else {
+			for len(words) > 0 && envRe.MatchString(words[0]) {
+				env = append(env, words[0])
+				words = words[1:]
+			}
+			args = words
+		}
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = p.Dir
+	cmd.Env = append(os.Environ(), cs.env()...)
+	cmd.Env = append(cmd.Env, p.Env...)
+	cmd.Env = append(cmd.Env, env...)
+	return cmd, nil
+}
+
+// quoteWord quotes s for sh, unless it only has safe characters
+func quoteWord(s string) string {
+	if s != "" && safeWordRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// splitWords splits the line into words like sh, with single quotes,
+// double quotes and backslash escapes. operator is true if the line has
+// unquoted shell operators, e.g. pipes, redirections, && or $
+func splitWords(line string) (words []string, operator bool, err error) {
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '\\' && i+1 < len(line) && strings.IndexByte("$`\"\\\n", line[i+1]) >= 0:
+				i++
+				word.WriteByte(line[i])
+			default:
+				if c == '$' || c == '`' {
+					operator = true
+				}
+				word.WriteByte(c)
+			}
+		case c == '\\':
+			if i+1 < len(line) {
+				i++
+				word.WriteByte(line[i])
+			}
+			inWord = true
+		case c == '\'' || c == '"':
+			quote = rune(c)
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			if strings.IndexByte("|&;<>()$`*?[", c) >= 0 {
+				operator = true
+			}
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, false, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, operator, nil
+}
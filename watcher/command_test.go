@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	cases := []struct {
+		line     string
+		words    []string
+		operator bool
+		err      bool
+	}{
+		{"", nil, false, false},
+		{"  go  build\t./...\n", []string{"go", "build", "./..."}, false, false},
+		{`go build -o "bin/my api" ./cmd/api`, []string{"go", "build", "-o", "bin/my api", "./cmd/api"}, false, false},
+		{`echo 'a "b" \c'`, []string{"echo", `a "b" \c`}, false, false},
+		{`echo "a \"b\" \$c \d"`, []string{"echo", `a "b" $c \d`}, false, false},
+		{`echo a\ b \'c`, []string{"echo", "a b", "'c"}, false, false},
+		{`echo ""`, []string{"echo", ""}, false, false},
+		{`echo a''b`, []string{"echo", "ab"}, false, false},
+		{"CGO_ENABLED=0 go build", []string{"CGO_ENABLED=0", "go", "build"}, false, false},
+		{"make && make run", []string{"make", "&&", "make", "run"}, true, false},
+		{"go test | tee log", []string{"go", "test", "|", "tee", "log"}, true, false},
+		{"echo $HOME", []string{"echo", "$HOME"}, true, false},
+		{`echo "$HOME"`, []string{"echo", "$HOME"}, true, false},
+		{"echo `date`", []string{"echo", "`date`"}, true, false},
+		{"ls *.go", []string{"ls", "*.go"}, true, false},
+		{"echo '$HOME | *'", []string{"echo", "$HOME | *"}, false, false},
+		{`echo "a`, nil, false, true},
+		{`echo 'a`, nil, false, true},
+	}
+	for _, c := range cases {
+		words, operator, err := splitWords(c.line)
+		if (err != nil) != c.err {
+			t.Errorf("%q err %v", c.line, err)
+			continue
+		}
+		if c.err {
+			continue
+		}
+		if !reflect.DeepEqual(words, c.words) || operator != c.operator {
+			t.Errorf("%q got %q %v want %q %v", c.line, words, operator, c.words, c.operator)
+		}
+	}
+}
+
+func TestQuoteWord(t *testing.T) {
+	for _, s := range []string{"a.go", "./pkg/a-b_c", "", "a b.go", "a;`touch x`.go", "it's", "$HOME", `a"b\c`} {
+		q := quoteWord(s)
+		words, operator, err := splitWords("echo " + q)
+		if err != nil || operator || len(words) != 2 || words[1] != s {
+			t.Errorf("%q quoted %s got %q %v %v", s, q, words, operator, err)
+		}
+	}
+	if q := quoteWord("./pkg/a.go"); q != "./pkg/a.go" {
+		t.Errorf("safe word quoted %s", q)
+	}
+}
+
+func TestCommandUnmarshal(t *testing.T) {
+	cases := []struct {
+		in   string
+		want command
+		err  bool
+	}{
+		{`"go build ./..."`, command{Line: "go build ./..."}, false},
+		{`["go", "vet", "{{.Dirs}}"]`, command{Args: []string{"go", "vet", "{{.Dirs}}"}}, false},
+		{`{"line": "make", "shell": true, "dir": "api", "env": ["A=1"]}`, command{Line: "make", Shell: true, Dir: "api", Env: []string{"A=1"}}, false},
+		{`{"line": "make", "args": ["make"]}`, command{}, true},
+		{`1`, command{}, true},
+	}
+	for _, c := range cases {
+		var got command
+		err := json.Unmarshal([]byte(c.in), &got)
+		if (err != nil) != c.err {
+			t.Errorf("%s err %v", c.in, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s got %+v want %+v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCommandBuild(t *testing.T) {
+	cs := newChangeSet("api", "/tmp/changes")
+	cs.Files = fileList{"a b.go", "c.go"}
+	cs.Dirs = fileList{"."}
+
+	cases := []struct {
+		cmd  command
+		args []string
+		env  []string
+		err  bool
+	}{
+		{command{Line: "go vet {{.Dirs}}"}, []string{"go", "vet", "."}, nil, false},
+		{command{Line: "gofmt -l {{.Files}}"}, []string{"gofmt", "-l", "a b.go", "c.go"}, nil, false},
+		{command{Line: "CGO_ENABLED=0 go build"}, []string{"go", "build"}, []string{"CGO_ENABLED=0"}, false},
+		{command{Line: "make && make run"}, []string{"/bin/sh", "-c", "make && make run"}, nil, false},
+		{command{Line: "echo {{.Files}}", Shell: true}, []string{"/bin/sh", "-c", "echo 'a b.go' c.go"}, nil, false},
+		{command{Args: []string{"gofmt", "-l", "{{.Files}}"}, Env: []string{"A=1"}}, []string{"gofmt", "-l", "a b.go", "c.go"}, []string{"A=1"}, false},
+		{command{Args: []string{"echo", "--files={{.Files}}"}}, []string{"echo", "--files=a b.go c.go"}, nil, false},
+		{command{Line: "docker ps --format {{.Names}}"}, []string{"docker", "ps", "--format", "{{.Names}}"}, nil, false},
+		{command{Line: "A=1"}, nil, nil, true},
+		{command{Line: " "}, nil, nil, true},
+	}
+	for _, c := range cases {
+		cmd, err := c.cmd.build(cs)
+		if (err != nil) != c.err {
+			t.Errorf("%s err %v", c.cmd, err)
+			continue
+		}
+		if c.err {
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, c.args) {
+			t.Errorf("%s args got %q want %q", c.cmd, cmd.Args, c.args)
+		}
+		env := strings.Join(cmd.Env, "\n")
+		for _, v := range append(c.env, "WATCHER_PIPELINE=api", "WATCHER_FILES=a b.go c.go") {
+			if !strings.Contains(env, v) {
+				t.Errorf("%s env missing %s", c.cmd, v)
+			}
+		}
+	}
+}
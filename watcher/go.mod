@@ -3,8 +3,10 @@ module github.com/yubo/gotool/watcher
 go 1.16
 
 require (
+	github.com/bmatcuk/doublestar/v4 v4.6.1
 	github.com/fsnotify/fsnotify v1.5.1
 	github.com/spf13/cobra v1.1.1
 	github.com/yubo/golib v0.0.2-0.20220317183542-cd89a563a6bb
 	k8s.io/klog/v2 v2.9.0
+	sigs.k8s.io/yaml v1.2.0
 )
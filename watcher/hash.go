@@ -0,0 +1,111 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// fileSums records the last seen state of the watched files to drop
+// the events which don't change them
+type fileSums struct {
+	sync.Mutex
+	hash bool // compare the content when the size or mtime changed
+	sums map[string]*fileSum
+}
+
+type fileSum struct {
+	modTime time.Time
+	size    int64
+	hash    []byte
+}
+
+func newFileSums(hash bool) *fileSums {
+	return &fileSums{
+		hash: hash,
+		sums: make(map[string]*fileSum),
+	}
+}
+
+// changed records the current state of the file and returns true if it
+// differs from the last one, a removed file is always changed
+func (p *fileSums) changed(name string) bool {
+	name = filepath.Clean(name)
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		p.Lock()
+		delete(p.sums, name)
+		p.Unlock()
+		return true
+	}
+
+	sum := &fileSum{modTime: fi.ModTime(), size: fi.Size()}
+
+	p.Lock()
+	old, ok := p.sums[name]
+	p.Unlock()
+
+	if ok && old.size == sum.size && old.modTime.Equal(sum.modTime) {
+		return false
+	}
+
+	if p.hash {
+		if sum.hash, err = hashFile(name); err != nil {
+			klog.V(4).Infof("hash %s: %s", name, err)
+		}
+	}
+
+	p.Lock()
+	p.sums[name] = sum
+	p.Unlock()
+
+	if ok && p.hash && sum.hash != nil && old.size == sum.size && bytes.Equal(old.hash, sum.hash) {
+		klog.V(7).Infof("%s is touched without changes", name)
+		return false
+	}
+	return true
+}
+
+// removeDir drops the files below dir and returns their names
+func (p *fileSums) removeDir(dir string) []string {
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+
+	p.Lock()
+	defer p.Unlock()
+
+	var names []string
+	for name := range p.sums {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+			delete(p.sums, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hashFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSums(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "a.go")
+	mtime := time.Now().Add(-time.Hour)
+	write := func(content string) func() error {
+		return func() error {
+			if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+				return err
+			}
+			mtime = mtime.Add(time.Second)
+			return os.Chtimes(file, mtime, mtime)
+		}
+	}
+	touch := func() error {
+		mtime = mtime.Add(time.Second)
+		return os.Chtimes(file, mtime, mtime)
+	}
+
+	steps := []struct {
+		name   string
+		change func() error
+		hash   bool // changed with hash
+		nohash bool // changed without hash
+	}{
+		{"create", write("package a"), true, true},
+		{"unchanged", func() error { return nil }, false, false},
+		{"touch", touch, false, true},
+		{"same content", write("package a"), false, true},
+		{"same size", write("package b"), true, true},
+		{"grow", write("package ab"), true, true},
+		{"remove", func() error { return os.Remove(file) }, true, true},
+		{"recreate", write("package ab"), true, true},
+	}
+
+	hashed, plain := newFileSums(true), newFileSums(false)
+	for _, s := range steps {
+		if err := s.change(); err != nil {
+			t.Fatal(err)
+		}
+		if got := hashed.changed(file); got != s.hash {
+			t.Errorf("%s: hash changed got %v want %v", s.name, got, s.hash)
+		}
+		if got := plain.changed(file); got != s.nohash {
+			t.Errorf("%s: changed got %v want %v", s.name, got, s.nohash)
+		}
+	}
+}
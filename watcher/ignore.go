@@ -0,0 +1,165 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"k8s.io/klog/v2"
+)
+
+// ignoreFiles are read from each scanned directory when gitignore is set
+var ignoreFiles = []string{".gitignore", ".watcherignore"}
+
+// rule is a gitignore style pattern, relative to base
+type rule struct {
+	base    string // absolute directory the pattern is relative to
+	pattern string // doublestar pattern
+	negate  bool   // "!" prefix
+	dirOnly bool   // "/" suffix
+}
+
+// rules are evaluated in order, the last matched one wins
+type rules []*rule
+
+// newRule parses a gitignore style pattern:
+//
+//	vendor       vendor at any depth
+//	/vendor      vendor in base only
+//	build/       directories only
+//	**/*.go      doublestar glob
+//	!*_test.go   negation
+func newRule(base, pattern string) (*rule, error) {
+	r := &rule{base: base}
+
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	// patterns without a slash match the name at any depth
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		pattern = "**/" + pattern
+	}
+
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	r.pattern = pattern
+
+	return r, nil
+}
+
+// newRules parses the patterns relative to each of the bases
+func newRules(bases []string, patterns []string) (rules, error) {
+	var ret rules
+	for _, v := range patterns {
+		for _, base := range bases {
+			r, err := newRule(base, v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", v, err)
+			}
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+// ruleBases returns the directories the patterns of the config are
+// relative to, the working directory and the include paths outside of
+// it, e.g. ../shared
+func ruleBases(wd string, includes []string) []string {
+	bases := []string{wd}
+	for _, v := range includes {
+		abs, err := filepath.Abs(v)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(wd, abs); err == nil && !isOutside(rel) {
+			continue
+		}
+		bases = append(bases, abs)
+	}
+	return bases
+}
+
+// isOutside returns true if the relative path leaves its base
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// fileRules converts the file exts to rules, a plain ext like ".go"
+// is the same as "*.go"
+func fileRules(bases []string, exts []string) (rules, error) {
+	patterns := make([]string, len(exts))
+	for i, v := range exts {
+		if strings.HasPrefix(v, ".") && !strings.ContainsAny(v, `*?[{/\`) {
+			v = "*" + v
+		}
+		patterns[i] = v
+	}
+	return newRules(bases, patterns)
+}
+
+// match returns true if the absolute path is matched by the rules,
+// matched is the result of the previous rules
+func (p rules) match(path string, isDir, matched bool) bool {
+	for _, r := range p {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(r.base, path)
+		if err != nil || rel == "." || isOutside(rel) {
+			continue
+		}
+		if ok, _ := doublestar.Match(r.pattern, filepath.ToSlash(rel)); ok {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+// readIgnoreFiles returns the rules of the ignore files in dir
+func readIgnoreFiles(dir string) rules {
+	var ret rules
+	for _, name := range ignoreFiles {
+		file := filepath.Join(dir, name)
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimRight(scanner.Text(), " \t\r")
+			// escaped "\#" and "\!" are left to doublestar
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			r, err := newRule(dir, line)
+			if err != nil {
+				klog.Warningf("%s:%d: %s", file, n, err)
+				continue
+			}
+			ret = append(ret, r)
+		}
+		f.Close()
+	}
+	return ret
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	base := "/src"
+	cases := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{[]string{"vendor"}, "/src/vendor", true, true},
+		{[]string{"vendor"}, "/src/a/vendor", true, true},
+		{[]string{"/vendor"}, "/src/vendor", true, true},
+		{[]string{"/vendor"}, "/src/a/vendor", true, false},
+		{[]string{"build/"}, "/src/build", true, true},
+		{[]string{"build/"}, "/src/build", false, false},
+		{[]string{"a/*.go"}, "/src/a/b.go", false, true},
+		{[]string{"a/*.go"}, "/src/x/a/b.go", false, false},
+		{[]string{"**/*.go", "!**/*_test.go"}, "/src/a/b.go", false, true},
+		{[]string{"**/*.go", "!**/*_test.go"}, "/src/a/b_test.go", false, false},
+		{[]string{"*.go"}, "/src", true, false},
+		{[]string{"*.go"}, "/other/a.go", false, false},
+		{[]string{"*.go"}, "/src/..a/b.go", false, true},
+	}
+	for _, c := range cases {
+		rs, err := newRules([]string{base}, c.patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rs.match(c.path, c.isDir, false); got != c.want {
+			t.Errorf("%v match %s got %v want %v", c.patterns, c.path, got, c.want)
+		}
+	}
+
+	for _, v := range []string{"", "!", "/", "a/[b"} {
+		if _, err := newRule(base, v); err == nil {
+			t.Errorf("expected error for pattern %q", v)
+		}
+	}
+}
+
+func TestFileRules(t *testing.T) {
+	cases := []struct {
+		exts []string
+		path string
+		want bool
+	}{
+		{[]string{".go"}, "/src/a/b.go", true},
+		{[]string{".go"}, "/src/a/b.gox", false},
+		{[]string{".go", "!*_test.go"}, "/src/a/b_test.go", false},
+		{[]string{"cmd/**/*.go"}, "/src/cmd/a/b.go", true},
+		{[]string{"cmd/**/*.go"}, "/src/pkg/b.go", false},
+	}
+	for _, c := range cases {
+		rs, err := fileRules([]string{"/src"}, c.exts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rs.match(c.path, false, false); got != c.want {
+			t.Errorf("%v match %s got %v want %v", c.exts, c.path, got, c.want)
+		}
+	}
+}
+
+func TestRuleBases(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := filepath.Join(filepath.Dir(wd), "shared")
+
+	bases := ruleBases(wd, []string{".", "sub", "../shared", "/abs/dir"})
+	if want := []string{wd, shared, "/abs/dir"}; !reflect.DeepEqual(bases, want) {
+		t.Fatalf("bases got %v want %v", bases, want)
+	}
+
+	files, err := fileRules(bases, []string{".go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excludes, err := newRules(bases, []string{"/gen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		rs    rules
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{files, filepath.Join(shared, "a.go"), false, true},
+		{files, filepath.Join(wd, "sub/a.go"), false, true},
+		{files, filepath.Join(filepath.Dir(wd), "other/a.go"), false, false},
+		{excludes, filepath.Join(shared, "gen"), true, true},
+		{excludes, filepath.Join(wd, "gen"), true, true},
+		{excludes, filepath.Join(shared, "a/gen"), true, false},
+	}
+	for _, c := range cases {
+		if got := c.rs.match(c.path, c.isDir, false); got != c.want {
+			t.Errorf("match %s got %v want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestReadIgnoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	content := "# comment\n\n*.log\n!keep.log\nbuild/\n/tmp\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".watcherignore"), []byte("*.out\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := readIgnoreFiles(dir)
+	if len(rs) != 5 {
+		t.Fatalf("got %d rules want 5", len(rs))
+	}
+
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"a/b.log", false, true},
+		{"a/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"tmp", true, true},
+		{"a/tmp", true, false},
+		{"a.out", false, true},
+		{"a.go", false, false},
+		{"../a.log", false, false},
+	}
+	for _, c := range cases {
+		if got := rs.match(filepath.Join(dir, c.path), c.isDir, false); got != c.want {
+			t.Errorf("match %s got %v want %v", c.path, got, c.want)
+		}
+	}
+}
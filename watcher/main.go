@@ -5,11 +5,13 @@ package main
 
 import (
 	"os"
+	"os/signal"
 
 	"github.com/spf13/cobra"
 	"github.com/yubo/golib/cli/globalflag"
 	"github.com/yubo/golib/configer"
 	"github.com/yubo/golib/logs"
+	"k8s.io/klog/v2"
 )
 
 func main() {
@@ -36,15 +38,40 @@ func newRootCmd() *cobra.Command {
 	return cmd
 }
 
+// watch runs the pipelines concurrently until interrupted
 func watch(cf *config) error {
-	watcher, err := NewWatcher(cf)
+	pipelines, err := cf.pipelines()
 	if err != nil {
 		return err
 	}
 
-	if done, err := watcher.Do(); err != nil {
+	var watchers []*watcher
+	done := make(chan error, len(pipelines))
+	for _, pl := range pipelines {
+		watcher, err := NewWatcher(pl)
+		if err != nil {
+			return err
+		}
+
+		d, err := watcher.Do()
+		if err != nil {
+			return err
+		}
+		watchers = append(watchers, watcher)
+		go func() { done <- <-d }()
+	}
+
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt)
+
+	select {
+	case <-sigs:
+		klog.V(1).Infof("recv shutdown signal, exiting")
+		for _, watcher := range watchers {
+			watcher.close()
+		}
+		return nil
+	case err := <-done:
 		return err
-	} else {
-		return <-done
 	}
 }
@@ -0,0 +1,42 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// notifier is the source of the file system events of the watched
+// directories, either inotify or polling
+type notifier interface {
+	Add(dir string) error
+	Remove(dir string) error
+	Close() error
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+}
+
+type fsNotifier struct {
+	*fsnotify.Watcher
+}
+
+func newFsNotifier() (notifier, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &fsNotifier{w}, nil
+}
+
+func (p *fsNotifier) Events() <-chan fsnotify.Event { return p.Watcher.Events }
+func (p *fsNotifier) Errors() <-chan error          { return p.Watcher.Errors }
+
+// isWatchLimit returns true if err is caused by the inotify limits,
+// fs.inotify.max_user_watches or max_user_instances
+func isWatchLimit(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
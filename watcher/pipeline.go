@@ -0,0 +1,163 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/yubo/golib/api"
+	"sigs.k8s.io/yaml"
+)
+
+// pipeline is a named set of watched paths and the commands executed
+// when one of the files changes, e.g.
+//
+//	pipelines:
+//	- name: api
+//	  include: ["."]
+//	  exclude: ["vendor", "web/"]
+//	  exts: ["**/*.go", "!**/*_test.go"]
+//	  gitignore: true
+//	  hash: true
+//	  delay: 500ms
+//	  stages:
+//	  - name: generate
+//	    cmd: go generate ./...
+//	    when: ["**/*.proto"]
+//	  - name: build
+//	    cmd: go build -o bin/api ./cmd/api
+//	    timeout: 2m
+//	  - name: test
+//	    cmd: go test {{.Dirs}}
+//	    onFailure: continue
+//	  - name: run
+//	    cmd: bin/api
+//	    longRunning: true
+//	    stopSignal: INT
+//	    stopTimeout: 5s
+//	    restart: true
+//	    maxRestarts: 5
+//	- name: proto
+//	  include: ["proto"]
+//	  exts: [".proto"]
+//	  poll: true
+//	  pollInterval: 2s
+//	  cmd: make proto
+type pipeline struct {
+	Name          string       `json:"name"`
+	IncludePaths  []string     `json:"include"`
+	ExcludedPaths []string     `json:"exclude"`
+	FileExts      []string     `json:"exts"`
+	Gitignore     bool         `json:"gitignore"`
+	Poll          bool         `json:"poll"`
+	PollInterval  api.Duration `json:"pollInterval"`
+	Hash          bool         `json:"hash"`
+	PidFilePath   string       `json:"pidFile"`
+	Delay         api.Duration `json:"delay"`
+	Stages        []*stage     `json:"stages"`
+
+	// defaults of the stages
+	stopOptions
+	restartOptions
+
+	// replaced by stages
+	Cmd1 command `json:"c1"`
+	Cmd2 command `json:"c2"`
+	Cmd  command `json:"cmd"`
+}
+
+type pipelineFile struct {
+	Pipelines []*pipeline `json:"pipelines"`
+}
+
+// pipelines returns the pipelines of the config file, or a single
+// "default" pipeline built from the flags
+func (p *config) pipelines() ([]*pipeline, error) {
+	if p.ConfigFile == "" {
+		pl := &pipeline{
+			Name:          "default",
+			IncludePaths:  p.IncludePaths,
+			ExcludedPaths: p.ExcludedPaths,
+			FileExts:      p.FileExts,
+			Gitignore:     p.Gitignore,
+			Poll:          p.Poll,
+			PollInterval:  p.PollInterval,
+			Hash:          p.Hash,
+			PidFilePath:   p.PidFilePath,
+			Delay:         p.Delay,
+			stopOptions: stopOptions{
+				StopSignal:   p.StopSignal,
+				StopTimeout:  p.StopTimeout,
+				ReloadSignal: p.ReloadSignal,
+			},
+			restartOptions: restartOptions{
+				Restart:      p.Restart,
+				RestartDelay: p.RestartDelay,
+				MaxRestarts:  p.MaxRestarts,
+			},
+			Stages: legacyStages(
+				command{Line: p.Cmd, Shell: p.Shell},
+				command{Line: p.Cmd1, Shell: p.Shell},
+				command{Line: p.Cmd2, Shell: p.Shell},
+			),
+		}
+		return []*pipeline{pl}, validateStages(pl)
+	}
+
+	return loadPipelines(p.ConfigFile)
+}
+
+func loadPipelines(file string) ([]*pipeline, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &pipelineFile{}
+	if err := yaml.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("parse %s: %s", file, err)
+	}
+	if len(f.Pipelines) == 0 {
+		return nil, fmt.Errorf("no pipelines defined in %s", file)
+	}
+
+	names := map[string]bool{}
+	for i, v := range f.Pipelines {
+		if v.Name == "" {
+			return nil, fmt.Errorf("%s: pipeline %d has no name", file, i)
+		}
+		if names[v.Name] {
+			return nil, fmt.Errorf("%s: duplicate pipeline %s", file, v.Name)
+		}
+		names[v.Name] = true
+
+		legacy := !v.Cmd.empty() || !v.Cmd1.empty() || !v.Cmd2.empty()
+		switch {
+		case len(v.Stages) > 0 && legacy:
+			return nil, fmt.Errorf("%s: pipeline %s has both stages and cmd/c1/c2", file, v.Name)
+		case legacy:
+			v.Stages = legacyStages(v.Cmd, v.Cmd1, v.Cmd2)
+		case len(v.Stages) == 0:
+			return nil, fmt.Errorf("%s: pipeline %s has no stages", file, v.Name)
+		}
+		if err := validateStages(v); err != nil {
+			return nil, fmt.Errorf("%s: pipeline %s: %s", file, v.Name, err)
+		}
+		if len(v.FileExts) == 0 {
+			return nil, fmt.Errorf("%s: pipeline %s has no exts", file, v.Name)
+		}
+		if len(v.IncludePaths) == 0 {
+			v.IncludePaths = []string{"."}
+		}
+		if v.Delay.Duration == 0 {
+			v.Delay = api.NewDuration("500ms")
+		}
+		if v.PollInterval.Duration == 0 {
+			v.PollInterval = api.NewDuration("1s")
+		}
+	}
+
+	return f.Pipelines, nil
+}
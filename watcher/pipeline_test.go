@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func writePipelines(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "watcher.yaml")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadPipelines(t *testing.T) {
+	file := writePipelines(t, `
+pipelines:
+- name: api
+  include: ["cmd", "pkg"]
+  exts: [".go"]
+  stopSignal: INT
+  stages:
+  - name: build
+    cmd: go build ./...
+  - cmd: bin/api
+    longRunning: true
+    stopSignal: HUP
+- name: proto
+  exts: [".proto"]
+  delay: 1s
+  cmd: make proto
+`)
+	pls, err := loadPipelines(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pls) != 2 {
+		t.Fatalf("got %d pipelines want 2", len(pls))
+	}
+
+	api, proto := pls[0], pls[1]
+	if api.Name != "api" || !reflect.DeepEqual(api.IncludePaths, []string{"cmd", "pkg"}) ||
+		api.Delay.Duration != 500*time.Millisecond || api.PollInterval.Duration != time.Second {
+		t.Errorf("unexpected pipeline %+v", api)
+	}
+	if len(api.Stages) != 2 || api.Stages[0].Name != "build" || api.Stages[1].Name != "stage1" {
+		t.Fatalf("unexpected stages %+v", api.Stages)
+	}
+	if s := api.Stages[0]; s.stopSignal != syscall.SIGINT || s.OnFailure != onFailureStop {
+		t.Errorf("stage %s got %v %s", s.Name, s.stopSignal, s.OnFailure)
+	}
+	if s := api.Stages[1]; s.stopSignal != syscall.SIGHUP || !s.LongRunning {
+		t.Errorf("stage %s got %v %v", s.Name, s.stopSignal, s.LongRunning)
+	}
+
+	if !reflect.DeepEqual(proto.IncludePaths, []string{"."}) || proto.Delay.Duration != time.Second {
+		t.Errorf("unexpected pipeline %+v", proto)
+	}
+	if len(proto.Stages) != 1 || proto.Stages[0].Cmd.Line != "make proto" || !proto.Stages[0].LongRunning {
+		t.Errorf("unexpected legacy stages %+v", proto.Stages)
+	}
+}
+
+func TestLoadPipelinesError(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{"invalid yaml", "pipelines: [\n"},
+		{"no pipelines", "pipelines: []\n"},
+		{"no name", "pipelines:\n- exts: [.go]\n  cmd: make\n"},
+		{"duplicate name", "pipelines:\n- {name: a, exts: [.go], cmd: make}\n- {name: a, exts: [.go], cmd: make}\n"},
+		{"no stages", "pipelines:\n- {name: a, exts: [.go]}\n"},
+		{"stages and cmd", "pipelines:\n- {name: a, exts: [.go], cmd: make, stages: [{cmd: make}]}\n"},
+		{"stage without cmd", "pipelines:\n- {name: a, exts: [.go], stages: [{name: build}]}\n"},
+		{"duplicate stage", "pipelines:\n- {name: a, exts: [.go], stages: [{name: b, cmd: make}, {name: b, cmd: make}]}\n"},
+		{"invalid onFailure", "pipelines:\n- {name: a, exts: [.go], stages: [{cmd: make, onFailure: retry}]}\n"},
+		{"invalid stopSignal", "pipelines:\n- {name: a, exts: [.go], stages: [{cmd: make, stopSignal: FOO}]}\n"},
+		{"invalid stage", "pipelines:\n- {name: a, exts: [.go], stages: [make]}\n"},
+		{"no exts", "pipelines:\n- {name: a, cmd: make}\n"},
+	}
+	for _, c := range cases {
+		if _, err := loadPipelines(writePipelines(t, c.content)); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+
+	if _, err := loadPipelines(filepath.Join(t.TempDir(), "nonexistent.yaml")); err == nil {
+		t.Errorf("expected error for a missing file")
+	}
+}
+
+func TestConfigPipelines(t *testing.T) {
+	cases := []struct {
+		name       string
+		configFile string
+		names      []string
+		includes   []string
+		stages     []string
+		stop       syscall.Signal
+	}{
+		{"flags", "", []string{"default"}, []string{"flag"}, []string{"build", "run"}, syscall.SIGINT},
+		{"config overrides the flags",
+			writePipelines(t, "pipelines:\n- {name: api, exts: [.go], stages: [{name: test, cmd: go test}]}\n"),
+			[]string{"api"}, []string{"."}, []string{"test"}, syscall.SIGTERM},
+	}
+	for _, c := range cases {
+		cf := newConfig()
+		cf.ConfigFile = c.configFile
+		cf.IncludePaths = []string{"flag"}
+		cf.StopSignal = "INT"
+
+		pls, err := cf.pipelines()
+		if err != nil {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+		var names, stages []string
+		for _, pl := range pls {
+			names = append(names, pl.Name)
+			for _, s := range pl.Stages {
+				stages = append(stages, s.Name)
+			}
+		}
+		if !reflect.DeepEqual(names, c.names) || !reflect.DeepEqual(stages, c.stages) ||
+			!reflect.DeepEqual(pls[0].IncludePaths, c.includes) || pls[0].Stages[0].stopSignal != c.stop {
+			t.Errorf("%s: got %v %v %v %v", c.name, names, stages, pls[0].IncludePaths, pls[0].Stages[0].stopSignal)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// poller is a notifier for the file systems without inotify support,
+// e.g. nfs, sshfs or docker bind mounts, it compares the mtime and size
+// of the directory entries every interval
+type poller struct {
+	sync.Mutex
+	dirs   map[string]map[string]fileStat // dir -> name -> stat
+	events chan fsnotify.Event
+	errors chan error
+	done   chan struct{}
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+func newPoller(interval time.Duration) *poller {
+	p := &poller{
+		dirs:   make(map[string]map[string]fileStat),
+		events: make(chan fsnotify.Event),
+		errors: make(chan error),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.poll()
+			}
+		}
+	}()
+
+	return p
+}
+
+func (p *poller) Add(dir string) error {
+	stats, err := readDirStat(dir)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.dirs[dir] = stats
+	return nil
+}
+
+func (p *poller) Remove(dir string) error {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.dirs, dir)
+	return nil
+}
+
+func (p *poller) Close() error {
+	close(p.done)
+	return nil
+}
+
+func (p *poller) Events() <-chan fsnotify.Event { return p.events }
+func (p *poller) Errors() <-chan error          { return p.errors }
+
+// poll sends the changes of the watched dirs since the last poll
+func (p *poller) poll() {
+	p.Lock()
+	var events []fsnotify.Event
+	for dir, olds := range p.dirs {
+		stats, err := readDirStat(dir)
+		if err != nil {
+			// removed, reported by the parent directory
+			continue
+		}
+
+		for name, s := range stats {
+			o, ok := olds[name]
+			switch {
+			case !ok:
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Create})
+			case !s.isDir && (!s.modTime.Equal(o.modTime) || s.size != o.size):
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Write})
+			}
+		}
+		for name := range olds {
+			if _, ok := stats[name]; !ok {
+				events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+			}
+		}
+		p.dirs[dir] = stats
+	}
+	p.Unlock()
+
+	// the receiver may call Add or Remove
+	for _, e := range events {
+		select {
+		case p.events <- e:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func readDirStat(dir string) (map[string]fileStat, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]fileStat, len(fileInfos))
+	for _, fi := range fileInfos {
+		stats[fi.Name()] = fileStat{modTime: fi.ModTime(), size: fi.Size(), isDir: fi.IsDir()}
+	}
+	return stats, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestPoller(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.go")
+	if err := ioutil.WriteFile(file, []byte("package a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// polled by hand
+	p := newPoller(time.Hour)
+	defer p.Close()
+	if err := p.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	poll := func() map[string]fsnotify.Op {
+		got := map[string]fsnotify.Op{}
+		done := make(chan struct{})
+		go func() {
+			p.poll()
+			close(done)
+		}()
+		for {
+			select {
+			case e := <-p.Events():
+				rel, _ := filepath.Rel(dir, e.Name)
+				got[rel] |= e.Op
+			case <-done:
+				return got
+			}
+		}
+	}
+
+	mtime := time.Now().Add(-time.Hour)
+	steps := []struct {
+		name   string
+		change func() error
+		want   map[string]fsnotify.Op
+	}{
+		{"unchanged", func() error { return nil }, map[string]fsnotify.Op{}},
+		{"write", func() error {
+			return ioutil.WriteFile(file, []byte("package ab"), 0644)
+		}, map[string]fsnotify.Op{"a.go": fsnotify.Write}},
+		{"touch", func() error {
+			return os.Chtimes(file, mtime, mtime)
+		}, map[string]fsnotify.Op{"a.go": fsnotify.Write}},
+		{"create", func() error {
+			if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(filepath.Join(dir, "b.go"), nil, 0644)
+		}, map[string]fsnotify.Op{"sub": fsnotify.Create, "b.go": fsnotify.Create}},
+		{"subdir not added", func() error {
+			return ioutil.WriteFile(filepath.Join(dir, "sub", "c.go"), nil, 0644)
+		}, map[string]fsnotify.Op{}},
+		{"remove", func() error {
+			return os.Remove(file)
+		}, map[string]fsnotify.Op{"a.go": fsnotify.Remove}},
+	}
+	for _, s := range steps {
+		if err := s.change(); err != nil {
+			t.Fatal(err)
+		}
+		if got := poll(); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: got %v want %v", s.name, got, s.want)
+		}
+	}
+
+	if err := p.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "d.go"), nil, 0644)
+	if got := poll(); len(got) != 0 {
+		t.Errorf("removed dir: got %v", got)
+	}
+}
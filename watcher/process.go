@@ -0,0 +1,237 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yubo/golib/api"
+	"k8s.io/klog/v2"
+)
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+}
+
+// stopOptions is how the process of a long running stage is stopped,
+// or reloaded instead of restarted
+type stopOptions struct {
+	StopSignal   string       `json:"stopSignal"`   // default TERM
+	StopTimeout  api.Duration `json:"stopTimeout"`  // grace period before SIGKILL, default 10s
+	ReloadSignal string       `json:"reloadSignal"` // e.g. HUP, sent instead of restarting
+
+	stopSignal   syscall.Signal
+	reloadSignal syscall.Signal
+}
+
+// setDefaults fills the unset options from def and parses the signals
+func (p *stopOptions) setDefaults(def stopOptions) (err error) {
+	if p.StopSignal == "" {
+		p.StopSignal = def.StopSignal
+	}
+	if p.StopTimeout.Duration == 0 {
+		p.StopTimeout = def.StopTimeout
+	}
+	if p.ReloadSignal == "" {
+		p.ReloadSignal = def.ReloadSignal
+	}
+
+	if p.StopSignal == "" {
+		p.StopSignal = "TERM"
+	}
+	if p.StopTimeout.Duration == 0 {
+		p.StopTimeout = api.NewDuration("10s")
+	}
+
+	if p.stopSignal, err = parseSignal(p.StopSignal); err != nil {
+		return err
+	}
+	if p.ReloadSignal != "" {
+		if p.reloadSignal, err = parseSignal(p.ReloadSignal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restartOptions is how the process of a long running stage is
+// restarted when it crashes, the delay doubles after each restart
+type restartOptions struct {
+	Restart      bool         `json:"restart"`      // restart on a non-zero exit
+	RestartDelay api.Duration `json:"restartDelay"` // default 1s
+	MaxRestarts  int          `json:"maxRestarts"`  // until the next change, 0 is unlimited
+}
+
+const maxRestartDelay = time.Minute
+
+func (p *restartOptions) setDefaults(def restartOptions) {
+	p.Restart = p.Restart || def.Restart
+	if p.RestartDelay.Duration == 0 {
+		p.RestartDelay = def.RestartDelay
+	}
+	if p.MaxRestarts == 0 {
+		p.MaxRestarts = def.MaxRestarts
+	}
+
+	if p.RestartDelay.Duration == 0 {
+		p.RestartDelay = api.NewDuration("1s")
+	}
+}
+
+// backoff returns the delay of the nth restart
+func (p *restartOptions) backoff(n int) time.Duration {
+	d := p.RestartDelay.Duration
+	for i := 0; i < n && d < maxRestartDelay; i++ {
+		d *= 2
+	}
+	if d > maxRestartDelay {
+		d = maxRestartDelay
+	}
+	return d
+}
+
+// parseSignal parses a signal name, e.g. HUP, SIGHUP or 1
+func parseSignal(s string) (syscall.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	if sig, ok := signals[name]; ok {
+		return sig, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	return 0, fmt.Errorf("invalid signal %q", s)
+}
+
+// process is a started cmd, done is closed when it exits
+type process struct {
+	cmd     *exec.Cmd
+	pidFile string
+	done    chan struct{}
+	err     error // of cmd.Wait
+}
+
+func startProcess(cmd *exec.Cmd, pidFile string) (*process, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{cmd: cmd, pidFile: pidFile, done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (p *process) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// pid returns the pid read from the pid file, or the pid of the cmd
+func (p *process) pid() int {
+	if p.pidFile != "" {
+		b, err := ioutil.ReadFile(p.pidFile)
+		if err != nil {
+			klog.Errorf("open pid file %s err %s", p.pidFile, err)
+		} else if pid, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+			return pid
+		}
+	}
+	return p.cmd.Process.Pid
+}
+
+// signal sends sig to the process group, or to the process if the pid
+// of the pid file doesn't lead a group
+func (p *process) signal(sig syscall.Signal) error {
+	return p.signalPid(p.pid(), sig)
+}
+
+func (p *process) signalPid(pid int, sig syscall.Signal) error {
+	klog.V(3).Infof("Signal(%s) pid(%d)", sig, pid)
+	err := syscall.Kill(-pid, sig)
+	if err == syscall.ESRCH && pid != p.cmd.Process.Pid {
+		err = syscall.Kill(pid, sig)
+	}
+	if err != nil && err != syscall.ESRCH {
+		return err
+	}
+	return nil
+}
+
+// killTimeout is how long stop waits for the exit after SIGKILL
+const killTimeout = 5 * time.Second
+
+// stop sends sig to the process and waits for the exit, the process and
+// the cmd are killed after timeout
+func (p *process) stop(sig syscall.Signal, timeout time.Duration) {
+	pid := p.pid()
+	if err := p.signalPid(pid, sig); err != nil {
+		klog.V(3).Infof("kill(%d) err %v", pid, err)
+	}
+
+	if p.wait(pid, timeout) {
+		klog.V(3).Infof("killed(%d)", pid)
+		return
+	}
+
+	klog.V(3).Infof("kill(KILL) pid(%d)", pid)
+	p.signalPid(pid, syscall.SIGKILL)
+	if pid != p.cmd.Process.Pid {
+		p.signalPid(p.cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	select {
+	case <-p.done:
+	case <-time.After(killTimeout):
+		klog.Errorf("process %d didn't exit %s after SIGKILL", p.cmd.Process.Pid, killTimeout)
+	}
+}
+
+// wait returns true if the cmd, and the process of the pid file if it
+// differs, exited before timeout
+func (p *process) wait(pid int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	select {
+	case <-p.done:
+	case <-deadline.C:
+		return false
+	}
+
+	if pid == p.cmd.Process.Pid {
+		return true
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/yubo/golib/api"
+)
+
+func TestParseSignal(t *testing.T) {
+	cases := []struct {
+		in   string
+		want syscall.Signal
+		err  bool
+	}{
+		{"HUP", syscall.SIGHUP, false},
+		{"SIGHUP", syscall.SIGHUP, false},
+		{"sigterm", syscall.SIGTERM, false},
+		{"int", syscall.SIGINT, false},
+		{"usr2", syscall.SIGUSR2, false},
+		{"9", syscall.SIGKILL, false},
+		{"0", 0, true},
+		{"-1", 0, true},
+		{"SIGFOO", 0, true},
+		{"", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseSignal(c.in)
+		if (err != nil) != c.err || got != c.want {
+			t.Errorf("%q got %v %v want %v", c.in, got, err, c.want)
+		}
+	}
+}
+
+func TestStopOptions(t *testing.T) {
+	cases := []struct {
+		opts    stopOptions
+		def     stopOptions
+		stop    syscall.Signal
+		timeout time.Duration
+		reload  syscall.Signal
+		err     bool
+	}{
+		{stopOptions{}, stopOptions{}, syscall.SIGTERM, 10 * time.Second, 0, false},
+		{stopOptions{}, stopOptions{StopSignal: "INT", StopTimeout: api.NewDuration("1s"), ReloadSignal: "HUP"},
+			syscall.SIGINT, time.Second, syscall.SIGHUP, false},
+		{stopOptions{StopSignal: "QUIT"}, stopOptions{StopSignal: "INT"}, syscall.SIGQUIT, 10 * time.Second, 0, false},
+		{stopOptions{StopSignal: "FOO"}, stopOptions{}, 0, 0, 0, true},
+		{stopOptions{ReloadSignal: "FOO"}, stopOptions{}, 0, 0, 0, true},
+	}
+	for i, c := range cases {
+		err := c.opts.setDefaults(c.def)
+		if (err != nil) != c.err {
+			t.Errorf("case %d err %v", i, err)
+			continue
+		}
+		if c.err {
+			continue
+		}
+		if c.opts.stopSignal != c.stop || c.opts.StopTimeout.Duration != c.timeout || c.opts.reloadSignal != c.reload {
+			t.Errorf("case %d got %v %s %v", i, c.opts.stopSignal, c.opts.StopTimeout.Duration, c.opts.reloadSignal)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cases := []struct {
+		delay string
+		n     int
+		want  time.Duration
+	}{
+		{"", 0, time.Second},
+		{"", 1, 2 * time.Second},
+		{"", 3, 8 * time.Second},
+		{"", 6, maxRestartDelay},
+		{"", 1000, maxRestartDelay},
+		{"100ms", 2, 400 * time.Millisecond},
+		{"2m", 0, maxRestartDelay},
+	}
+	for _, c := range cases {
+		opts := restartOptions{}
+		if c.delay != "" {
+			opts.RestartDelay = api.NewDuration(c.delay)
+		}
+		opts.setDefaults(restartOptions{})
+		if got := opts.backoff(c.n); got != c.want {
+			t.Errorf("delay %q backoff(%d) got %s want %s", c.delay, c.n, got, c.want)
+		}
+	}
+}
+
+func TestProcessStop(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		sig  syscall.Signal
+	}{
+		{"term", "sleep 30", syscall.SIGTERM},
+		{"ignore term", "trap '' TERM; sleep 30 & wait", syscall.SIGTERM},
+	}
+	for _, c := range cases {
+		proc, err := startProcess(exec.Command("/bin/sh", "-c", c.line), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		proc.stop(c.sig, 200*time.Millisecond)
+		if proc.running() {
+			t.Errorf("%s: still running after stop", c.name)
+		}
+		if d := time.Since(start); d > killTimeout {
+			t.Errorf("%s: stop took %s", c.name, d)
+		}
+	}
+}
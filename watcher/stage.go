@@ -0,0 +1,293 @@
+// Copyright 2015-2020 yubo. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yubo/golib/api"
+	"k8s.io/klog/v2"
+)
+
+const (
+	onFailureStop     = "stop"
+	onFailureContinue = "continue"
+)
+
+// stage is a step run on each batch of changes, in order. A blocking
+// stage is waited for, a long running one is restarted and left running
+type stage struct {
+	Name        string       `json:"name"`
+	Cmd         command      `json:"cmd"`
+	LongRunning bool         `json:"longRunning"`
+	When        []string     `json:"when"`      // run only if a changed file matches, like exts
+	OnFailure   string       `json:"onFailure"` // stop (default) or continue
+	Timeout     api.Duration `json:"timeout"`   // of a blocking stage
+	stopOptions
+	restartOptions
+
+	when      rules
+	printsCmd bool // the cmd prints the long running command, legacy c2
+}
+
+// legacyStages converts the cmd, c1 and c2 commands to stages, the
+// first line printed by c2 is the long running command
+func legacyStages(cmd, c1, c2 command) []*stage {
+	if !cmd.empty() {
+		return []*stage{{Name: "run", Cmd: cmd, LongRunning: true}}
+	}
+
+	var stages []*stage
+	if !c1.empty() {
+		stages = append(stages, &stage{Name: "build", Cmd: c1})
+	}
+	if !c2.empty() {
+		stages = append(stages, &stage{Name: "run", Cmd: c2, LongRunning: true, printsCmd: true})
+	}
+	return stages
+}
+
+// validateStages checks the stages of the pipeline and fills their
+// unset stop and restart options from the pipeline
+func validateStages(pl *pipeline) error {
+	names := map[string]bool{}
+	for i, s := range pl.Stages {
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("stage%d", i)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate stage %s", s.Name)
+		}
+		names[s.Name] = true
+
+		if s.Cmd.empty() {
+			return fmt.Errorf("stage %s has no cmd", s.Name)
+		}
+		switch s.OnFailure {
+		case "":
+			s.OnFailure = onFailureStop
+		case onFailureStop, onFailureContinue:
+		default:
+			return fmt.Errorf("stage %s: invalid onFailure %q, must be stop or continue", s.Name, s.OnFailure)
+		}
+		if err := s.stopOptions.setDefaults(pl.stopOptions); err != nil {
+			return fmt.Errorf("stage %s: %s", s.Name, err)
+		}
+		s.restartOptions.setDefaults(pl.restartOptions)
+	}
+	return nil
+}
+
+// match returns true if the stage should run for the change set, the
+// first batch runs all the stages
+func (p *stage) match(cs *changeSet) bool {
+	if len(p.when) == 0 || len(cs.Changes) == 0 {
+		return true
+	}
+	for _, c := range cs.Changes {
+		if abs, err := filepath.Abs(c.Name); err == nil && p.when.match(abs, false, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// runStages runs the stages matched by the change set until one fails
+// with the stop policy
+func (p *watcher) runStages(cs *changeSet) {
+	for i, s := range p.Stages {
+		if p.isClosed() {
+			return
+		}
+		if !s.match(cs) {
+			klog.V(3).Infof("[%s/%s] skipped", p.Name, s.Name)
+			continue
+		}
+
+		var err error
+		if s.LongRunning {
+			err = p.startStage(i, cs)
+		} else {
+			err = p.runStage(s, cs)
+		}
+		if err == nil {
+			continue
+		}
+
+		klog.Errorf("[%s/%s] %s", p.Name, s.Name, err)
+		if s.OnFailure == onFailureStop {
+			return
+		}
+	}
+}
+
+// runStage runs a blocking stage until it exits or times out
+func (p *watcher) runStage(s *stage, cs *changeSet) error {
+	cmd, err := s.Cmd.build(cs)
+	if err != nil {
+		return err
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.setBlocking(cmd)
+	defer p.setBlocking(nil)
+
+	timeout := make(chan struct{})
+	if s.Timeout.Duration > 0 {
+		t := time.AfterFunc(s.Timeout.Duration, func() {
+			close(timeout)
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer t.Stop()
+	}
+
+	err = cmd.Wait()
+	klog.Infof("---------- [%s/%s] %s -------", p.Name, s.Name, cs)
+
+	select {
+	case <-timeout:
+		err = fmt.Errorf("timeout after %s", s.Timeout.Duration)
+	default:
+	}
+	if err != nil {
+		klog.Error(output.String())
+		return err
+	}
+
+	klog.V(3).Info(output.String())
+	klog.V(3).Infof("[%s/%s] Successfully!", p.Name, s.Name)
+	return nil
+}
+
+// startStage kills the process of the long running stage i and starts
+// it again, or sends it the reload signal if it's still running
+func (p *watcher) startStage(i int, cs *changeSet) error {
+	s := p.Stages[i]
+	if proc := p.proc(i); proc != nil && proc.running() && s.reloadSignal != 0 {
+		klog.Infof("---------- [%s/%s] reload %s -------", p.Name, s.Name, cs)
+		return proc.signal(s.reloadSignal)
+	}
+	return p.spawn(i, cs, 0)
+}
+
+// spawn starts the process of the long running stage i, restarts is
+// the number of crash restarts since the last change
+func (p *watcher) spawn(i int, cs *changeSet, restarts int) error {
+	s := p.Stages[i]
+	p.kill(i)
+
+	cmd, err := p.stageCmd(s, cs)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	pidFile := ""
+	if i == p.pidStage {
+		pidFile = p.PidFilePath
+	}
+	proc, err := startProcess(cmd, pidFile)
+	if err != nil {
+		return err
+	}
+	p.setProc(i, proc)
+
+	klog.V(3).Infof("[%s/%s] Process %d execute %s", p.Name, s.Name, cmd.Process.Pid, cmd)
+	if restarts > 0 {
+		klog.Infof("[%s/%s] UP: restarted %d times, pid %d", p.Name, s.Name, restarts, cmd.Process.Pid)
+	}
+
+	go p.supervise(i, proc, cs, restarts)
+	return nil
+}
+
+// stageCmd returns the cmd of the long running stage, if printsCmd is
+// set the cmd is run first and its first line is the one returned
+func (p *watcher) stageCmd(s *stage, cs *changeSet) (*exec.Cmd, error) {
+	cmd, err := s.Cmd.build(cs)
+	if err != nil || !s.printsCmd {
+		return cmd, err
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	p.setBlocking(cmd)
+	err = cmd.Wait()
+	p.setBlocking(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", s.Cmd, err)
+	}
+
+	line := strings.TrimSpace(strings.SplitN(output.String(), "\n", 2)[0])
+	if line == "" {
+		return nil, fmt.Errorf("%s printed no command", s.Cmd)
+	}
+	klog.V(3).Infof("[%s/%s] %s printed %s", p.Name, s.Name, s.Cmd, line)
+
+	return command{Line: line, Dir: s.Cmd.Dir, Env: s.Cmd.Env}.build(cs)
+}
+
+// supervise waits for the process of the long running stage i, and
+// restarts it with backoff if it crashed
+func (p *watcher) supervise(i int, proc *process, cs *changeSet, restarts int) {
+	s := p.Stages[i]
+	pid := proc.cmd.Process.Pid
+
+	<-proc.done
+	if proc.err != nil {
+		klog.Infof("[%s/%s] Process %d exit %v", p.Name, s.Name, pid, proc.err)
+	} else {
+		klog.Infof("[%s/%s] Process %d exit 0", p.Name, s.Name, pid)
+	}
+
+	// stopped by kill
+	if p.proc(i) != proc {
+		return
+	}
+
+	switch {
+	case proc.err == nil || !s.Restart:
+		klog.Warningf("[%s/%s] DOWN: waiting for changes", p.Name, s.Name)
+		return
+	case s.MaxRestarts > 0 && restarts >= s.MaxRestarts:
+		klog.Warningf("[%s/%s] DOWN: gave up after %d restarts, waiting for changes", p.Name, s.Name, restarts)
+		return
+	}
+
+	delay := s.backoff(restarts)
+	klog.Warningf("[%s/%s] DOWN: crashed, restart %d in %s", p.Name, s.Name, restarts+1, delay)
+	time.Sleep(delay)
+
+	p.Lock()
+	defer p.Unlock()
+
+	// restarted by a change or closed meanwhile
+	if p.proc(i) != proc || p.isClosed() {
+		return
+	}
+	if err := p.spawn(i, cs, restarts+1); err != nil {
+		klog.Errorf("[%s/%s] %s", p.Name, s.Name, err)
+	}
+}
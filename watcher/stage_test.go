@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yubo/golib/api"
+	"k8s.io/klog/v2"
+)
+
+func TestLegacyStages(t *testing.T) {
+	cases := []struct {
+		cmd, c1, c2 command
+		want        []*stage
+	}{
+		{command{Line: "go run ."}, command{Line: "make"}, command{Line: "make -s devrun"},
+			[]*stage{{Name: "run", Cmd: command{Line: "go run ."}, LongRunning: true}}},
+		{command{}, command{Line: "make"}, command{Line: "make -s devrun"},
+			[]*stage{
+				{Name: "build", Cmd: command{Line: "make"}},
+				{Name: "run", Cmd: command{Line: "make -s devrun"}, LongRunning: true, printsCmd: true},
+			}},
+		{command{}, command{Line: "make"}, command{},
+			[]*stage{{Name: "build", Cmd: command{Line: "make"}}}},
+		{command{}, command{}, command{Args: []string{"make", "-s", "devrun"}},
+			[]*stage{{Name: "run", Cmd: command{Args: []string{"make", "-s", "devrun"}}, LongRunning: true, printsCmd: true}}},
+		{command{}, command{Line: " "}, command{}, nil},
+	}
+	for i, c := range cases {
+		if got := legacyStages(c.cmd, c.c1, c.c2); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d got %+v want %+v", i, got, c.want)
+		}
+	}
+}
+
+func TestStageCmd(t *testing.T) {
+	p := &watcher{pipeline: &pipeline{Name: "test"}}
+	cs := newChangeSet("test", "")
+
+	cases := []struct {
+		line string
+		args []string
+		err  bool
+	}{
+		{"echo sleep 1", []string{"sleep", "1"}, false},
+		{"printf 'sleep 2\\nsleep 3\\n'", []string{"sleep", "2"}, false},
+		{"true", nil, true},
+		{"echo sleep 1; false", nil, true},
+	}
+	for _, c := range cases {
+		s := &stage{Name: "run", Cmd: command{Line: c.line}, LongRunning: true, printsCmd: true}
+		cmd, err := p.stageCmd(s, cs)
+		if (err != nil) != c.err {
+			t.Errorf("%s err %v", c.line, err)
+			continue
+		}
+		if !c.err && !reflect.DeepEqual(cmd.Args, c.args) {
+			t.Errorf("%s got %q want %q", c.line, cmd.Args, c.args)
+		}
+	}
+}
+
+func TestValidateStages(t *testing.T) {
+	cases := []struct {
+		stages []*stage
+		err    bool
+	}{
+		{[]*stage{{Cmd: command{Line: "make"}}, {Cmd: command{Line: "make run"}, LongRunning: true}}, false},
+		{[]*stage{{Name: "a", Cmd: command{Line: "make"}}, {Name: "a", Cmd: command{Line: "make"}}}, true},
+		{[]*stage{{Name: "a"}}, true},
+		{[]*stage{{Cmd: command{Line: "make"}, OnFailure: "retry"}}, true},
+		{[]*stage{{Cmd: command{Line: "make"}, stopOptions: stopOptions{StopSignal: "FOO"}}}, true},
+	}
+	for i, c := range cases {
+		err := validateStages(&pipeline{Stages: c.stages})
+		if (err != nil) != c.err {
+			t.Errorf("case %d err %v", i, err)
+		}
+	}
+
+	pl := &pipeline{Stages: []*stage{{Cmd: command{Line: "make"}}}}
+	pl.StopSignal = "INT"
+	if err := validateStages(pl); err != nil {
+		t.Fatal(err)
+	}
+	if s := pl.Stages[0]; s.Name != "stage0" || s.OnFailure != onFailureStop || s.StopSignal != "INT" {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+}
+
+func TestStageMatch(t *testing.T) {
+	when, err := fileRules(ruleBases("/src", nil), []string{"*.proto"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stage{when: when}
+
+	cases := []struct {
+		changes []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{"/src/a.go"}, false},
+		{[]string{"/src/a.go", "/src/api/a.proto"}, true},
+	}
+	for _, c := range cases {
+		cs := newChangeSet("test", "")
+		for _, name := range c.changes {
+			cs.add(fsnotify.Event{Name: name, Op: fsnotify.Write})
+		}
+		if got := s.match(cs); got != c.want {
+			t.Errorf("%v got %v want %v", c.changes, got, c.want)
+		}
+	}
+
+	if !(&stage{}).match(newChangeSet("test", "")) {
+		t.Errorf("stage without when should match")
+	}
+}
+
+// syncBuffer collects the klog output written by the supervise goroutines
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (p *syncBuffer) Write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+	return p.buf.Write(b)
+}
+
+func (p *syncBuffer) String() string {
+	p.Lock()
+	defer p.Unlock()
+	return p.buf.String()
+}
+
+func TestSupervise(t *testing.T) {
+	fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(fs)
+	fs.Set("logtostderr", "false")
+	fs.Set("alsologtostderr", "false")
+	defer fs.Set("logtostderr", "true")
+
+	cases := []struct {
+		name        string
+		exit        string
+		restart     bool
+		maxRestarts int
+		runs        int
+		logs        []string // in order, the last one is waited for
+	}{
+		{"crash", "exit 1", true, 3, 4, []string{
+			"DOWN: crashed, restart 1 in 20ms",
+			"UP: restarted 1 times",
+			"DOWN: crashed, restart 2 in 40ms",
+			"UP: restarted 2 times",
+			"DOWN: crashed, restart 3 in 80ms",
+			"UP: restarted 3 times",
+			"DOWN: gave up after 3 restarts",
+		}},
+		{"clean exit", "exit 0", true, 3, 1, []string{"DOWN: waiting for changes"}},
+		{"no restart", "exit 1", false, 3, 1, []string{"DOWN: waiting for changes"}},
+	}
+	for _, c := range cases {
+		out := &syncBuffer{}
+		klog.SetOutput(out)
+
+		runs := filepath.Join(t.TempDir(), "runs")
+		pl := &pipeline{Name: "test", Stages: []*stage{
+			{Name: "run", Cmd: command{Line: "echo >> " + runs + "; " + c.exit}, LongRunning: true},
+		}}
+		pl.Restart = c.restart
+		pl.RestartDelay = api.NewDuration("20ms")
+		pl.MaxRestarts = c.maxRestarts
+		if err := validateStages(pl); err != nil {
+			t.Fatal(err)
+		}
+		p := &watcher{pipeline: pl, procs: make([]*process, len(pl.Stages)), pidStage: -1}
+
+		start := time.Now()
+		p.autoBuild(newChangeSet("test", ""))
+		for !strings.Contains(out.String(), c.logs[len(c.logs)-1]) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("%s: %q not logged in\n%s", c.name, c.logs[len(c.logs)-1], out)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// a crash after giving up is not restarted
+		time.Sleep(100 * time.Millisecond)
+		p.close()
+
+		log := out.String()
+		for i, pos := 0, 0; i < len(c.logs); i++ {
+			n := strings.Index(log[pos:], c.logs[i])
+			if n < 0 {
+				t.Errorf("%s: %q not logged in order in\n%s", c.name, c.logs[i], log)
+				break
+			}
+			pos += n
+		}
+		if c.runs > 1 {
+			if d := time.Since(start); d < 140*time.Millisecond {
+				t.Errorf("%s: restarted %d times in %s", c.name, c.runs-1, d)
+			}
+		}
+
+		b, err := ioutil.ReadFile(runs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(string(b), "\n"); n != c.runs {
+			t.Errorf("%s: got %d runs want %d", c.name, n, c.runs)
+		}
+	}
+}
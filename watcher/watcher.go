@@ -8,10 +8,9 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -23,12 +22,23 @@ import (
 )
 
 type config struct {
-	includePaths  []string
+	ConfigFile    string       `flag:"config" description:"yaml file defining several named watch pipelines, overrides the other flags"`
 	IncludePaths  []string     `flag:"include,i" description:"list paths to include extra."`
-	ExcludedPaths []string     `flag:"exclude,e" description:"List of paths to exclude."`
-	FileExts      []string     `flag:"file,f" description:"List of file extension."`
-	PidFilePath   string       `flag:"pid" description:"pid file path"`
+	ExcludedPaths []string     `flag:"exclude,e" description:"List of gitignore style patterns to exclude, e.g. vendor, !vendor/foo"`
+	FileExts      []string     `flag:"file,f" description:"List of file extensions or glob patterns, e.g. .go, **/*.go, !**/*_test.go"`
+	Gitignore     bool         `flag:"gitignore" description:"exclude the files matched by .gitignore and .watcherignore"`
+	Poll          bool         `flag:"poll" description:"poll the file changes instead of inotify, e.g. for nfs, sshfs or docker bind mounts"`
+	PollInterval  api.Duration `flag:"poll-interval" description:"poll interval"`
+	Hash          bool         `flag:"hash" description:"compare the file content to ignore the events which don't change it, e.g. touch or git checkout"`
+	PidFilePath   string       `flag:"pid" description:"pid file path of the last long running stage"`
+	StopSignal    string       `flag:"stop-signal" description:"signal sent to stop the long running process, e.g. INT, TERM, HUP"`
+	StopTimeout   api.Duration `flag:"stop-timeout" description:"grace period after the stop signal before SIGKILL"`
+	ReloadSignal  string       `flag:"reload-signal" description:"signal sent to the running process instead of restarting it, e.g. HUP"`
+	Restart       bool         `flag:"restart" description:"restart the long running process when it crashes"`
+	RestartDelay  api.Duration `flag:"restart-delay" description:"delay of the first crash restart, doubled after each one"`
+	MaxRestarts   int          `flag:"max-restarts" description:"max crash restarts until the next change, 0 is unlimited"`
 	Delay         api.Duration `flag:"delay,d" description:"delay time when recv fs notify(Millisecond)"`
+	Shell         bool         `flag:"shell" description:"run the commands with /bin/sh -c"`
 	Cmd1          string       `flag:"c1" description:"run this cmd(c1) when recv inotify event"`
 	Cmd2          string       `flag:"c2" description:"invoke the cmd(c2) output when c1 is successfully executed"`
 	Cmd           string       `flag:"cmd" description:"run this cmd when recv inotify event(Conflict with --c1)"`
@@ -40,69 +50,130 @@ func newConfig() *config {
 		ExcludedPaths: []string{"vendor"},
 		FileExts:      []string{".go"},
 		Delay:         api.NewDuration("500ms"),
+		PollInterval:  api.NewDuration("1s"),
+		StopSignal:    "TERM",
+		StopTimeout:   api.NewDuration("10s"),
+		RestartDelay:  api.NewDuration("1s"),
 		Cmd1:          "make",
 		Cmd2:          "make -s devrun",
 	}
 }
 
 type watcher struct {
-	*config
-	*fsnotify.Watcher
+	*pipeline
+	notifier
 	sync.Mutex
 
-	cmd       *exec.Cmd
-	eventTime map[string]int64
+	dirs        map[string]bool // watched directories
+	files       rules           // from FileExts
+	excludes    rules           // from ExcludedPaths
+	ignores     rules           // from the ignore files
+	procLock    sync.Mutex
+	procs       []*process // processes of the long running stages
+	blocking    *exec.Cmd  // the running blocking stage
+	closed      bool       // no more stages are started
+	pidStage    int        // the last long running stage, PidFilePath is its pid file
+	sums        *fileSums
+	changesFile string // rewritten with the changes of each batch
 }
 
-func NewWatcher(cf *config) (*watcher, error) {
-	klog.Infof("include paths %v", cf.IncludePaths)
-	klog.Infof("excludedPaths %v", cf.ExcludedPaths)
-	klog.Infof("watch file exts %v", cf.FileExts)
+func NewWatcher(pl *pipeline) (*watcher, error) {
+	klog.Infof("[%s] include paths %v", pl.Name, pl.IncludePaths)
+	klog.Infof("[%s] excludedPaths %v", pl.Name, pl.ExcludedPaths)
+	klog.Infof("[%s] watch file exts %v", pl.Name, pl.FileExts)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	bases := ruleBases(wd, pl.IncludePaths)
 
 	watcher := &watcher{
-		config:    cf,
-		eventTime: make(map[string]int64),
+		pipeline: pl,
+		dirs:     make(map[string]bool),
+		sums:     newFileSums(pl.Hash),
+	}
+	if watcher.files, err = fileRules(bases, pl.FileExts); err != nil {
+		return nil, fmt.Errorf("[%s] exts %s", pl.Name, err)
+	}
+	if watcher.excludes, err = newRules(bases, pl.ExcludedPaths); err != nil {
+		return nil, fmt.Errorf("[%s] exclude %s", pl.Name, err)
+	}
+
+	watcher.procs = make([]*process, len(pl.Stages))
+	watcher.pidStage = -1
+	for i, s := range pl.Stages {
+		if s.when, err = fileRules(bases, s.When); err != nil {
+			return nil, fmt.Errorf("[%s/%s] when %s", pl.Name, s.Name, err)
+		}
+		if s.LongRunning {
+			watcher.pidStage = i
+		}
 	}
 
 	// expend currpath
-	for _, dir := range cf.IncludePaths {
+	for _, dir := range pl.IncludePaths {
 		watcher.readAppDirectories(dir)
 	}
 
 	return watcher, nil
-
 }
 
-// NewWatcher starts an fsnotify Watcher on the specified paths
+// Do starts watching the directories, inotify is used unless Poll is
+// set or the inotify limits are exhausted
 func (p *watcher) Do() (done <-chan error, err error) {
-	if p.Watcher, err = fsnotify.NewWatcher(); err != nil {
-		return nil, fmt.Errorf("Failed to create watcher: %s", err)
+	if p.Poll {
+		p.notifier = newPoller(p.PollInterval.Duration)
+	} else if p.notifier, err = newFsNotifier(); err != nil {
+		if !isWatchLimit(err) {
+			return nil, fmt.Errorf("Failed to create watcher: %s", err)
+		}
+		p.fallback(err)
+	}
+
+	klog.Infof("[%s] Initializing watcher...", p.Name)
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		klog.V(6).Infof("Watching: %s", dir)
+		if err := p.Add(dir); err != nil {
+			if !p.Poll && isWatchLimit(err) {
+				p.fallback(err)
+				break
+			}
+			klog.Fatalf("Failed to watch directory: %s", err)
+		}
+	}
+
+	f, err := ioutil.TempFile("", "watcher-*.changes")
+	if err != nil {
+		return nil, err
 	}
+	f.Close()
+	p.changesFile = f.Name()
 
 	done = make(chan error, 0)
 	buildEvent := make(chan *fsnotify.Event, 10)
 
 	go func() {
-		var ev *fsnotify.Event
-		sigs := make(chan os.Signal, 2)
-		signal.Notify(sigs, os.Interrupt)
-		pending := false
+		var cs *changeSet
 		ticker := time.NewTicker(p.Delay.Duration)
 		for {
 			select {
-			case <-sigs:
-				klog.V(1).Infof("recv shutdown signal, exiting")
-				p.kill()
-				os.Exit(0)
 			case e := <-buildEvent:
-				pending = true
-				ev = e
+				if cs == nil {
+					cs = newChangeSet(p.Name, p.changesFile)
+				}
+				cs.add(*e)
 				ticker.Stop()
 				ticker = time.NewTicker(p.Delay.Duration)
 			case <-ticker.C:
-				if pending {
-					p.autoBuild(ev)
-					pending = false
+				if cs != nil {
+					p.autoBuild(cs)
+					cs = nil
 				}
 			}
 		}
@@ -111,232 +182,282 @@ func (p *watcher) Do() (done <-chan error, err error) {
 	go func() {
 		for {
 			select {
-			case e := <-p.Events:
-				build := true
-
-				if !p.shouldWatchFileWithExtension(e.Name) {
-					continue
-				}
-
-				mt := GetFileModTime(e.Name)
-				if t := p.eventTime[e.Name]; mt == t {
-					klog.V(7).Info(e.String())
-					build = false
-				}
-
-				p.eventTime[e.Name] = mt
-
-				if build {
-					klog.V(7).Infof("Event fired: %s", e)
-					buildEvent <- &e
+			case e := <-p.Events():
+				for _, v := range p.fileEvents(e) {
+					v := v
+					buildEvent <- &v
 				}
-			case err := <-p.Errors:
-				klog.Warningf("Watcher error: %s", err.Error()) // No need to exit here
+			case err := <-p.Errors():
+				klog.Warningf("[%s] Watcher error: %s", p.Name, err.Error()) // No need to exit here
 			}
 		}
 	}()
 
-	klog.Info("Initializing watcher...")
-	for _, path := range p.includePaths {
-		klog.V(6).Infof("Watching: %s", path)
-		if err := p.Add(path); err != nil {
-			klog.Fatalf("Failed to watch directory: %s", err)
+	p.autoBuild(newChangeSet(p.Name, p.changesFile))
+	return
+}
+
+// fileEvents returns the events of the watched files for e, a created
+// or removed directory is expanded to the watched files below it
+func (p *watcher) fileEvents(e fsnotify.Event) []fsnotify.Event {
+	if e.Op&fsnotify.Create == fsnotify.Create && isDir(e.Name) {
+		if strings.HasPrefix(filepath.Base(e.Name), ".") || p.isExcluded(e.Name, true) {
+			return nil
 		}
+		klog.V(4).Infof("[%s] directory created: %s", p.Name, e.Name)
+		return newEvents(p.readAppDirectories(e.Name), fsnotify.Create)
 	}
-	p.autoBuild(&fsnotify.Event{Name: "first time", Op: fsnotify.Create})
-	return
+
+	if e.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && p.dirs[filepath.Clean(e.Name)] {
+		klog.V(4).Infof("[%s] directory removed: %s", p.Name, e.Name)
+		return newEvents(p.removeDir(e.Name), e.Op)
+	}
+
+	if !p.shouldWatchFile(e.Name) || p.isExcluded(e.Name, isDir(e.Name)) {
+		return nil
+	}
+
+	if !p.sums.changed(e.Name) {
+		klog.V(7).Info(e.String())
+		return nil
+	}
+
+	klog.V(7).Infof("Event fired: %s", e)
+	return []fsnotify.Event{e}
+}
+
+func newEvents(names []string, op fsnotify.Op) []fsnotify.Event {
+	events := make([]fsnotify.Event, len(names))
+	for i, name := range names {
+		events[i] = fsnotify.Event{Name: name, Op: op}
+	}
+	return events
 }
 
 // autoBuild builds the specified set of files
-func (p *watcher) autoBuild(e *fsnotify.Event) {
+func (p *watcher) autoBuild(cs *changeSet) {
 	p.Lock()
 	defer p.Unlock()
 
-	if p.Cmd == "" {
-		cmd := newCmd(p.Cmd1)
-		output, err := cmd.CombinedOutput()
-		klog.Infof("---------- %s -------", e)
-		if err != nil {
-			klog.Error(string(output))
-			klog.Error(err)
-			return
-		}
+	if p.isClosed() {
+		return
+	}
 
-		klog.V(3).Info(string(output))
-		klog.V(3).Info("Built Successfully!")
+	if err := cs.prepare(); err != nil {
+		klog.Warningf("[%s] write changes file: %s", p.Name, err)
 	}
 
-	p.restart()
+	p.runStages(cs)
 }
 
-// kill kills the running command process
-func (p *watcher) kill() {
-	defer func() {
-		if e := recover(); e != nil {
-			klog.Infof("Kill recover: %s", e)
-		}
-	}()
-	if p.cmd != nil && p.cmd.Process != nil {
-		pid := p.cmd.Process.Pid
-		if p.PidFilePath != "" {
-			byteContent, err := ioutil.ReadFile(p.PidFilePath)
-			if err == nil {
-				pidStr := strings.TrimSpace(string(byteContent))
-				id, err := strconv.Atoi(pidStr)
-				if err == nil {
-					pid = id
-				}
-			} else {
-				klog.Errorf("open pid file %s err %s", p.PidFilePath, err)
-			}
-		}
-		var err error
-		for i := 0; ; i++ {
-			if i < 10 {
-				klog.V(3).Infof("Signal(SIGTERM) pid(%d)", pid)
-				err = syscall.Kill(-pid, syscall.SIGTERM)
-			} else {
-				klog.V(3).Infof("kill(KILL) pid(%d)", pid)
-				err = syscall.Kill(-pid, syscall.SIGKILL)
-			}
-			if err == os.ErrProcessDone || err == syscall.ESRCH {
-				klog.V(3).Infof("killed(%d)", pid)
-				break
-			}
+// kill stops the process of the long running stage i
+func (p *watcher) kill(i int) {
+	p.procLock.Lock()
+	proc := p.procs[i]
+	p.procs[i] = nil
+	p.procLock.Unlock()
 
-			klog.V(3).Infof("kill(%d) err %v", pid, err)
-			time.Sleep(time.Second)
-		}
+	if proc != nil && proc.running() {
+		s := p.Stages[i]
+		proc.stop(s.stopSignal, s.StopTimeout.Duration)
 	}
 }
 
-// restart kills the running command process and starts it again
-func (p *watcher) restart() {
-	p.kill()
-	go p.start()
+func (p *watcher) proc(i int) *process {
+	p.procLock.Lock()
+	defer p.procLock.Unlock()
+	return p.procs[i]
 }
 
-func (p *watcher) getCmd() string {
-	if p.Cmd != "" {
-		return p.Cmd
-	}
-
-	cmd := newCmd(p.Cmd2)
-	output, err := cmd.Output()
-	if err != nil {
-		klog.Errorf("run %s err %s", p.Cmd2, err)
-	}
-	return strings.TrimSpace(strings.Split(string(output), "\n")[0])
+func (p *watcher) setProc(i int, proc *process) {
+	p.procLock.Lock()
+	defer p.procLock.Unlock()
+	p.procs[i] = proc
 }
 
-// start starts the command process
-func (p *watcher) start() {
-	cmd := p.getCmd()
-	if cmd == "" {
-		klog.Infof("cmd is empty")
-		return
+// setBlocking records the running blocking cmd, one started while
+// closing is killed
+func (p *watcher) setBlocking(cmd *exec.Cmd) {
+	p.procLock.Lock()
+	defer p.procLock.Unlock()
+	p.blocking = cmd
+	if cmd != nil && p.closed {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
 	}
+}
 
-	p.cmd = newCmd(cmd)
-	p.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	p.cmd.Stdout = os.Stdout
-	p.cmd.Stderr = os.Stderr
+func (p *watcher) isClosed() bool {
+	p.procLock.Lock()
+	defer p.procLock.Unlock()
+	return p.closed
+}
 
-	if err := p.cmd.Start(); err != nil {
-		klog.Infof("execute %s err %s", cmd, err)
-		return
+// close kills the running processes and removes the changes file. The
+// blocking stage is killed first so that autoBuild releases the lock,
+// the stages started under it check closed
+func (p *watcher) close() {
+	p.procLock.Lock()
+	p.closed = true
+	if p.blocking != nil {
+		syscall.Kill(-p.blocking.Process.Pid, syscall.SIGKILL)
 	}
+	p.procLock.Unlock()
 
-	klog.V(3).Infof("Process %d execute %s", p.cmd.Process.Pid, cmd)
+	p.Lock()
+	defer p.Unlock()
 
-	go func() {
-		if err := p.cmd.Wait(); err != nil {
-			klog.Infof("Process %d exit %v", p.cmd.Process.Pid, err)
-		} else {
-			klog.Infof("Process %d exit 0", p.cmd.Process.Pid)
-		}
-	}()
+	for i := range p.procs {
+		p.kill(i)
+	}
+	if p.changesFile != "" {
+		os.Remove(p.changesFile)
+	}
 }
 
-// shouldWatchFileWithExtension returns true if the name of the file
-// hash a suffix that should be watched.
-func (p *watcher) shouldWatchFileWithExtension(name string) bool {
-	for _, s := range p.FileExts {
-		if strings.HasSuffix(name, s) {
-			return true
-		}
+// shouldWatchFile returns true if the file is matched by the file
+// exts or patterns
+func (p *watcher) shouldWatchFile(name string) bool {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
 	}
-	return false
+	return p.files.match(abs, false, false)
 }
 
-// If a file is excluded
-func (p *watcher) isExcluded(file string) bool {
-	for _, p := range p.ExcludedPaths {
-		absP, err := filepath.Abs(p)
-		if err != nil {
-			klog.Errorf("Cannot get absolute path of '%s'", p)
-			continue
-		}
-		absFilePath, err := filepath.Abs(file)
-		if err != nil {
-			klog.Errorf("Cannot get absolute path of '%s'", file)
+// isExcluded returns true if the file or one of its parent directories
+// is matched by the ignore files or the exclude patterns, the latter
+// take precedence
+func (p *watcher) isExcluded(file string, isDir bool) bool {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		klog.Errorf("Cannot get absolute path of '%s'", file)
+		return true
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == filepath.Dir(dir) {
 			break
 		}
-		if strings.HasPrefix(absFilePath, absP) {
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if p.excludes.match(dirs[i], true, p.ignores.match(dirs[i], true, false)) {
 			klog.V(4).Infof("'%s' is not being watched", file)
 			return true
 		}
 	}
+
+	if p.excludes.match(abs, isDir, p.ignores.match(abs, isDir, false)) {
+		klog.V(4).Infof("'%s' is not being watched", file)
+		return true
+	}
 	return false
 }
 
-func (p *watcher) readAppDirectories(directory string) {
+// readAppDirectories adds the directory and its subdirectories to the
+// watched dirs, it returns the watched files found in them
+func (p *watcher) readAppDirectories(directory string) (files []string) {
 	fileInfos, err := ioutil.ReadDir(directory)
 	if err != nil {
-		return
+		return nil
+	}
+
+	if p.Gitignore {
+		if abs, err := filepath.Abs(directory); err == nil {
+			p.ignores = append(p.ignores, readIgnoreFiles(abs)...)
+		}
 	}
 
-	useDirectory := false
+	p.addDir(directory)
+
 	for _, fileInfo := range fileInfos {
-		if p.isExcluded(path.Join(directory, fileInfo.Name())) {
+		name := path.Join(directory, fileInfo.Name())
+		if p.isExcluded(name, fileInfo.IsDir()) {
 			continue
 		}
 
-		if fileInfo.IsDir() && fileInfo.Name()[0] != '.' {
-			p.readAppDirectories(directory + "/" + fileInfo.Name())
+		if fileInfo.IsDir() {
+			if fileInfo.Name()[0] != '.' {
+				files = append(files, p.readAppDirectories(name)...)
+			}
 			continue
 		}
 
-		if useDirectory {
-			continue
+		if p.shouldWatchFile(name) {
+			p.sums.changed(name)
+			files = append(files, name)
 		}
+	}
+	return files
+}
 
-		if p.shouldWatchFileWithExtension(fileInfo.Name()) {
-			p.includePaths = append(p.includePaths, directory)
-			useDirectory = true
+// addDir watches the directory, the dirs added before Do are watched
+// by Do
+func (p *watcher) addDir(dir string) {
+	dir = filepath.Clean(dir)
+	if p.dirs[dir] {
+		return
+	}
+	p.dirs[dir] = true
+
+	if p.notifier == nil {
+		return
+	}
+	klog.V(6).Infof("Watching: %s", dir)
+	if err := p.Add(dir); err != nil {
+		if !p.Poll && isWatchLimit(err) {
+			p.fallback(err)
+			return
 		}
+		klog.Warningf("[%s] Failed to watch directory: %s", p.Name, err)
 	}
 }
 
-// GetFileModTime returns unix timestamp of `os.File.ModTime` for the given path.
-func GetFileModTime(path string) int64 {
-	path = strings.Replace(path, "\\", "/", -1)
-	f, err := os.Open(path)
-	if err != nil {
-		//klog.Errorf("Failed to open file on '%s': %s", path, err)
-		return time.Now().Unix()
+// fallback switches to polling when the inotify limits are exhausted
+func (p *watcher) fallback(err error) {
+	klog.Warningf("[%s] %s, fall back to polling every %s", p.Name, err, p.PollInterval.Duration)
+
+	if p.notifier != nil {
+		p.notifier.Close()
 	}
-	defer f.Close()
+	p.Poll = true
+	p.notifier = newPoller(p.PollInterval.Duration)
+	for dir := range p.dirs {
+		if err := p.Add(dir); err != nil {
+			klog.Warningf("[%s] Failed to watch directory: %s", p.Name, err)
+		}
+	}
+}
 
-	fi, err := f.Stat()
-	if err != nil {
-		klog.Errorf("Failed to get file stats: %s", err)
-		return time.Now().Unix()
+// removeDir stops watching the directory and its subdirectories, and
+// drops the rules of their ignore files, it returns the watched files
+// which were in them
+func (p *watcher) removeDir(dir string) []string {
+	dir = filepath.Clean(dir)
+	for d := range p.dirs {
+		if d == dir || strings.HasPrefix(d, dir+string(filepath.Separator)) {
+			delete(p.dirs, d)
+			// the watch is gone already if the directory was deleted
+			p.Remove(d)
+		}
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		ignores := p.ignores[:0]
+		for _, r := range p.ignores {
+			if r.base != abs && !strings.HasPrefix(r.base, abs+string(filepath.Separator)) {
+				ignores = append(ignores, r)
+			}
+		}
+		p.ignores = ignores
 	}
-	return fi.ModTime().Unix()
+
+	return p.sums.removeDir(dir)
 }
 
-func newCmd(s string) *exec.Cmd {
-	c := strings.Fields(s)
-	return exec.Command(c[0], c[1:]...)
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
 }
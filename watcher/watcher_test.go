@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yubo/golib/api"
+)
+
+func TestWatchDirs(t *testing.T) {
+	dir := t.TempDir()
+	write := func(names ...string) {
+		for _, name := range names {
+			file := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	abs := func(names ...string) []string {
+		ret := make([]string, len(names))
+		for i, name := range names {
+			ret[i] = filepath.Join(dir, name)
+		}
+		return ret
+	}
+	watched := func(n notifier) []string {
+		var dirs []string
+		if pl, ok := n.(*poller); ok {
+			pl.Lock()
+			for d := range pl.dirs {
+				dirs = append(dirs, d)
+			}
+			pl.Unlock()
+		}
+		sort.Strings(dirs)
+		return dirs
+	}
+
+	write("a.go")
+	p, err := NewWatcher(&pipeline{
+		Name:          "test",
+		IncludePaths:  []string{dir},
+		ExcludedPaths: []string{"gen"},
+		FileExts:      []string{".go"},
+		PollInterval:  api.NewDuration("1h"), // the events are passed to fileEvents by the test
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.notifier, err = newFsNotifier(); err != nil {
+		t.Skip(err)
+	}
+	// the dirs are watched by the poller after the fallback
+	p.fallback(syscall.ENOSPC)
+	defer p.notifier.Close()
+	if _, ok := p.notifier.(*poller); !ok || !p.Poll {
+		t.Fatalf("expected the poller after the fallback, got %T", p.notifier)
+	}
+	if got, want := watched(p.notifier), abs(""); !reflect.DeepEqual(got, want) {
+		t.Fatalf("watched dirs got %v want %v", got, want)
+	}
+
+	cases := []struct {
+		name  string
+		setup func()
+		event fsnotify.Event
+		files []string
+		op    fsnotify.Op
+		dirs  []string
+	}{
+		{"create dir",
+			func() { write("sub/b.go", "sub/deep/c.go", "sub/x.txt", "sub/.git/d.go") },
+			fsnotify.Event{Name: filepath.Join(dir, "sub"), Op: fsnotify.Create},
+			abs("sub/b.go", "sub/deep/c.go"), fsnotify.Create, abs("", "sub", "sub/deep")},
+		{"create excluded dir",
+			func() { write("gen/e.go") },
+			fsnotify.Event{Name: filepath.Join(dir, "gen"), Op: fsnotify.Create},
+			abs(), 0, abs("", "sub", "sub/deep")},
+		{"unchanged file",
+			func() {},
+			fsnotify.Event{Name: filepath.Join(dir, "sub/b.go"), Op: fsnotify.Chmod},
+			abs(), 0, abs("", "sub", "sub/deep")},
+		{"rename dir",
+			func() {
+				if err := os.Rename(filepath.Join(dir, "sub/deep"), filepath.Join(dir, "moved")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			fsnotify.Event{Name: filepath.Join(dir, "sub/deep"), Op: fsnotify.Rename},
+			abs("sub/deep/c.go"), fsnotify.Rename, abs("", "sub")},
+		{"remove dir",
+			func() { os.RemoveAll(filepath.Join(dir, "sub")) },
+			fsnotify.Event{Name: filepath.Join(dir, "sub"), Op: fsnotify.Remove},
+			abs("sub/b.go"), fsnotify.Remove, abs("")},
+	}
+	for _, c := range cases {
+		c.setup()
+
+		cs := newChangeSet("test", "")
+		for _, e := range p.fileEvents(c.event) {
+			if e.Op != c.op {
+				t.Errorf("%s: %s got op %s want %s", c.name, e.Name, e.Op, c.op)
+			}
+			cs.add(e)
+		}
+		if err := cs.prepare(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([]string(cs.Files), c.files) {
+			t.Errorf("%s: files got %v want %v", c.name, cs.Files, c.files)
+		}
+
+		var dirs []string
+		for d := range p.dirs {
+			dirs = append(dirs, d)
+		}
+		sort.Strings(dirs)
+		if !reflect.DeepEqual(dirs, c.dirs) {
+			t.Errorf("%s: dirs got %v want %v", c.name, dirs, c.dirs)
+		}
+		if got := watched(p.notifier); !reflect.DeepEqual(got, c.dirs) {
+			t.Errorf("%s: watched dirs got %v want %v", c.name, got, c.dirs)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	pl := &pipeline{Name: "test", Stages: []*stage{
+		{Name: "build", Cmd: command{Line: "sleep 30"}, OnFailure: onFailureContinue},
+		{Name: "run", Cmd: command{Line: "touch " + started + " && sleep 30"}, LongRunning: true},
+	}}
+	if err := validateStages(pl); err != nil {
+		t.Fatal(err)
+	}
+	p := &watcher{pipeline: pl, procs: make([]*process, len(pl.Stages)), pidStage: -1}
+
+	done := make(chan struct{})
+	go func() {
+		p.autoBuild(newChangeSet("test", ""))
+		close(done)
+	}()
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		p.procLock.Lock()
+		running := p.blocking != nil
+		p.procLock.Unlock()
+		if running {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("build stage not started")
+		}
+	}
+
+	p.close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("autoBuild not returned after close")
+	}
+
+	// the changes after close are dropped
+	p.autoBuild(newChangeSet("test", ""))
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(started); err == nil || p.proc(1) != nil {
+		t.Errorf("run stage started after close")
+	}
+}